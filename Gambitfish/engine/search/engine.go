@@ -0,0 +1,78 @@
+// engine.go holds the state a search builds up and reuses between moves.
+package search
+
+import "../../game"
+
+// MAX_PLY is how far from the root a search can go, counting check
+// extensions and quiescence search.
+const MAX_PLY = 128
+
+// Engine searches positions with its own transposition table, pawn table,
+// move ordering tables and options. Independent engines can search at the same
+// time in one process, e.g. to play engine-vs-engine matches. A single
+// Engine runs one search at a time.
+type Engine struct {
+	Evaluator game.Evaluator
+	// Contempt is how many pawns worse than equal the side to move at the
+	// root thinks a draw is. Positive contempt avoids draws against weaker
+	// opponents; negative contempt seeks them against stronger ones.
+	Contempt float64
+	// TT is the transposition table, kept between searches. Engines
+	// analysing the same game can share one, each adding what it finds.
+	TT *game.TransTable
+	// Pawns is the engine's own pawn table, which NewEngine gives the
+	// evaluator if it can cache in one.
+	Pawns *game.PawnTable
+	// CopyMake searches by copying the board at every move, instead of
+	// making and unmaking moves on a single board.
+	CopyMake bool
+
+	killers game.KillerMoves
+	history *game.HistoryTable
+	// pickers hands out the moves at each ply, reusing the same buffers
+	// at every node.
+	pickers []game.MovePicker
+	// boards holds the position at each ply in copy-make searches.
+	boards []game.Board
+
+	// Search limits, see limits.go.
+	stopped         int32
+	deadline        int64
+	nodesSinceCheck int
+}
+
+// NewEngine returns an engine evaluating positions with e, with a
+// transposition table of hashMB megabytes. If e can cache in a pawn table,
+// the engine evaluates with a copy of e that uses its own, so engines can
+// be made from the same evaluator.
+func NewEngine(e game.Evaluator, hashMB int) *Engine {
+	game.InitInternalData()
+	en := &Engine{
+		Evaluator: e,
+		TT:        game.NewTransTable(hashMB),
+		killers:   game.NewKillerMoves(),
+		history:   &game.HistoryTable{},
+		pickers:   make([]game.MovePicker, MAX_PLY),
+		boards:    make([]game.Board, MAX_PLY+1),
+	}
+	if pe, ok := e.(game.PawnTableEvaluator); ok {
+		en.Pawns = game.NewPawnTable(game.DEFAULT_PAWN_HASH_MB)
+		en.Evaluator = pe.WithPawnTable(en.Pawns)
+	}
+	return en
+}
+
+// NewGame forgets everything learned from previous searches.
+func (en *Engine) NewGame() {
+	en.TT.Clear()
+	en.killers = game.NewKillerMoves()
+	en.history = &game.HistoryTable{}
+}
+
+// newSearch prepares the tables for searching a new position. Entries from
+// earlier searches are kept, but count for less.
+func (en *Engine) newSearch() {
+	en.TT.NewSearch()
+	en.killers = game.NewKillerMoves()
+	en.history.Age()
+}
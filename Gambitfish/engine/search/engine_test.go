@@ -0,0 +1,168 @@
+package search
+
+import "sync"
+import "testing"
+import "../../game"
+
+// Test that engines searching at the same time don't affect each other.
+func TestIndependentEngines(t *testing.T) {
+	game.InitInternalData()
+	fens := []string{
+		"r1bqkbnr/p1pp1ppp/1pn5/4p2Q/2B1P3/8/PPPP1PPP/RNB1K1NR w KQkq - 0 1",
+		"rnb1kbnr/pppp1ppp/8/4p1q1/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 1",
+		"2q5/pR6/1p3pnk/1P4pp/8/5QPP/P2r2BK/8 w - - 0 1",
+	}
+	search := func(fen string) Result {
+		b, err := game.BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("failed to read board from fen: %v", err)
+		}
+		return NewEngine(game.MaterialEvaluator{}, 1).IterativeDeepening(b, 3, nil)
+	}
+	want := make([]Result, len(fens))
+	for i, fen := range fens {
+		want[i] = search(fen)
+	}
+	got := make([]Result, len(fens))
+	var wg sync.WaitGroup
+	for i, fen := range fens {
+		wg.Add(1)
+		go func(i int, fen string) {
+			defer wg.Done()
+			got[i] = search(fen)
+		}(i, fen)
+	}
+	wg.Wait()
+	for i := range fens {
+		if got[i].Move != want[i].Move || got[i].Eval != want[i].Eval {
+			t.Errorf("%v: concurrent search got %v (%v), want %v (%v)", fens[i], got[i].Move, got[i].Eval, want[i].Move, want[i].Eval)
+		}
+	}
+
+	// Stopping one engine leaves the others alone.
+	a := NewEngine(game.MaterialEvaluator{}, 1)
+	b := NewEngine(game.MaterialEvaluator{}, 1)
+	a.Stop()
+	if !a.Stopped() || b.Stopped() {
+		t.Errorf("stopping one engine: got stopped %v and %v, want true and false", a.Stopped(), b.Stopped())
+	}
+}
+
+// Test that engines can share a transposition table while searching.
+// Run with -race.
+func TestSharedTable(t *testing.T) {
+	game.InitInternalData()
+	tt := game.NewTransTable(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			en := NewEngine(game.MaterialEvaluator{}, 1)
+			en.TT = tt
+			b := game.DefaultBoard()
+			res := en.IterativeDeepening(b, 3, nil)
+			if res.Move.Compact().Resolve(b.AllLegalMoves()) != res.Move {
+				t.Errorf("search with a shared table returned illegal move %v", res.Move)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Test that engines made from one evaluator that caches pawn structures
+// can search at the same time, each with its own pawn table. Run with
+// -race.
+func TestSharedEvaluator(t *testing.T) {
+	game.InitInternalData()
+	e := game.CompoundEvaluator{
+		Evaluators: []game.Evaluator{
+			game.MaterialEvaluator{},
+			game.PieceSquareEvaluator{},
+			game.KingSafetyEvaluator{},
+			game.PawnStructureEvaluator{},
+			game.PassedPawnEvaluator{},
+		},
+	}
+	engines := []*Engine{NewEngine(e, 1), NewEngine(e, 1)}
+	if engines[0].Pawns == nil || engines[0].Pawns == engines[1].Pawns {
+		t.Fatalf("engines got pawn tables %p and %p, want two different ones", engines[0].Pawns, engines[1].Pawns)
+	}
+	var wg sync.WaitGroup
+	for _, en := range engines {
+		wg.Add(1)
+		go func(en *Engine) {
+			defer wg.Done()
+			en.IterativeDeepening(game.DefaultBoard(), 4, nil)
+		}(en)
+	}
+	wg.Wait()
+	for i, en := range engines {
+		if en.Pawns.Probes == 0 {
+			t.Errorf("engine %v didn't use its pawn table", i)
+		}
+	}
+}
+
+// Test that copy-make searches the same tree as making and unmaking moves.
+func TestCopyMake(t *testing.T) {
+	game.InitInternalData()
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"2q5/pR6/1p3pnk/1P4pp/8/5QPP/P2r2BK/8 w - - 0 1",
+	}
+	for _, fen := range fens {
+		b, err := game.BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("failed to read board from fen: %v", err)
+		}
+		want := NewEngine(game.MaterialEvaluator{}, 1).IterativeDeepening(b, 4, nil)
+		en := NewEngine(game.MaterialEvaluator{}, 1)
+		en.CopyMake = true
+		got := en.IterativeDeepening(b, 4, nil)
+		if got.Move != want.Move || got.Eval != want.Eval || got.Stats.AllNodes() != want.Stats.AllNodes() {
+			t.Errorf("%v: copy-make got %v (%v, %v nodes), want %v (%v, %v nodes)", fen, got.Move, got.Eval, got.Stats.AllNodes(), want.Move, want.Eval, want.Stats.AllNodes())
+		}
+	}
+}
+
+// Test that engines can search the same board at once, as pondering and
+// analysis alongside a game do. Run with -race.
+func TestSharedBoard(t *testing.T) {
+	game.InitInternalData()
+	b := game.DefaultBoard()
+	var wg sync.WaitGroup
+	for _, copyMake := range []bool{false, true, false, true} {
+		wg.Add(1)
+		go func(copyMake bool) {
+			defer wg.Done()
+			en := NewEngine(game.MaterialEvaluator{}, 1)
+			en.CopyMake = copyMake
+			en.IterativeDeepening(b, 3, nil)
+		}(copyMake)
+	}
+	wg.Wait()
+	if b.Position != game.DefaultBoard().Position || len(b.Keys) != 1 {
+		t.Errorf("searching changed the board")
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	game.InitInternalData()
+	board, err := game.BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("failed to read board from fen: %v", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		copyMake bool
+	}{{"MakeUnmake", false}, {"CopyMake", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				en := NewEngine(game.MaterialEvaluator{}, 1)
+				en.CopyMake = tc.copyMake
+				en.IterativeDeepening(board, 4, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// iterative.go drives AlphaBetaSearch one ply deeper at a time.
+package search
+
+import "math"
+import "time"
+import "../../game"
+
+// Result is the outcome of an iterative deepening search.
+type Result struct {
+	Eval  float64 // From the point of view of the side to move.
+	Move  game.EfficientMove
+	Depth int
+	Stats Stats // Accumulated over every iteration.
+}
+
+// IterativeDeepening searches b for the active player one ply deeper at a
+// time up to maxDepth. It's likely that the best move on ply 1 is the best
+// on ply 2, so this fills the transposition table to lead with the best
+// move on future plies. If the search is stopped, the last completed
+// iteration is returned. report, if not nil, is called after every
+// completed iteration. The search works on its own copy of b, so b can be
+// used by other goroutines while it runs.
+func (en *Engine) IterativeDeepening(b *game.Board, maxDepth int, report func(Result)) Result {
+	en.newSearch()
+	// Leaving room for a search's worth of keys saves copy-make from
+	// growing them at every node.
+	b = b.Clone()
+	b.Keys = append(make([]uint64, 0, len(b.Keys)+MAX_PLY+1), b.Keys...)
+	alpha := math.Inf(-1)
+	beta := math.Inf(1)
+	var res Result
+	var stats Stats
+	for d := 1; d <= maxDepth; d++ {
+		start := time.Now()
+		st := Stats{}
+		eval, move := en.AlphaBetaSearch(b, d, 0, alpha, beta, false, b.Active, &st)
+		st.Time = time.Since(start)
+		stats.Add(st)
+		if en.Stopped() {
+			// An unfinished first iteration is still better than no move.
+			if res.Move == game.EfficientMove(0) {
+				res = Result{eval, move, d, stats}
+			}
+			res.Stats = stats
+			break
+		}
+		res = Result{eval, move, d, stats}
+		if report != nil {
+			report(Result{eval, move, d, st})
+		}
+	}
+	return res
+}
+
+// ExpectedReply returns the opponent's best reply to m according to the
+// transposition table, or 0 if we don't know one.
+func (en *Engine) ExpectedReply(b *game.Board, m game.EfficientMove) game.EfficientMove {
+	bs := game.ApplyMove(b, m)
+	b.SwitchActivePlayer()
+	reply := game.EfficientMove(0)
+	if entry, ok := en.TT.Probe(b.Hash); ok {
+		// Make sure a hash collision didn't give us nonsense.
+		reply = entry.BestMove.Resolve(b.AllLegalMoves())
+	}
+	game.UndoMove(b, m, bs)
+	b.SwitchActivePlayer()
+	return reply
+}
@@ -0,0 +1,59 @@
+// limits.go controls when a search in progress should give up, either
+// because it was told to stop or because it ran out of time.
+package search
+
+import "sync/atomic"
+import "time"
+
+// DEADLINE_CHECK_INTERVAL is how many nodes we search between looking at
+// the clock. Reading the time on every node is surprisingly expensive.
+const DEADLINE_CHECK_INTERVAL = 1024
+
+// Stop asks the engine's search in progress to return as soon as
+// possible. Results from a stopped search are incomplete: the iteration it
+// was working on should be thrown away. It is safe to call from another
+// goroutine.
+func (en *Engine) Stop() {
+	atomic.StoreInt32(&en.stopped, 1)
+}
+
+// Stopped returns true if the search has been stopped since the last Reset.
+func (en *Engine) Stopped() bool {
+	return atomic.LoadInt32(&en.stopped) == 1
+}
+
+// Reset clears any previous Stop and deadline so a new search can begin.
+func (en *Engine) Reset() {
+	atomic.StoreInt32(&en.stopped, 0)
+	atomic.StoreInt64(&en.deadline, 0)
+}
+
+// SetDeadline makes the search stop itself at time t. It is safe to call
+// while a search is running, which is how a ponder search is converted
+// into a normal timed search. A zero time removes the deadline.
+func (en *Engine) SetDeadline(t time.Time) {
+	if t.IsZero() {
+		atomic.StoreInt64(&en.deadline, 0)
+		return
+	}
+	atomic.StoreInt64(&en.deadline, t.UnixNano())
+}
+
+// shouldStop is called once per node and returns true if the search
+// needs to unwind.
+func (en *Engine) shouldStop() bool {
+	if en.Stopped() {
+		return true
+	}
+	en.nodesSinceCheck++
+	if en.nodesSinceCheck < DEADLINE_CHECK_INTERVAL {
+		return false
+	}
+	en.nodesSinceCheck = 0
+	d := atomic.LoadInt64(&en.deadline)
+	if d != 0 && time.Now().UnixNano() >= d {
+		en.Stop()
+		return true
+	}
+	return false
+}
@@ -13,54 +13,71 @@ const NULL_MOVE_REDUCED_SEARCH_DEPTH = 2
 
 // An Alpha Beta Negamax implementation. Function stolen from here:
 // https://en.wikipedia.org/wiki/Negamax#Negamax_with_alpha_beta_pruning
-func AlphaBetaSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta float64, nullMove bool, c game.Color, km game.KillerMoves) (float64, game.EfficientMove, int) {
-	// The number of nodes searched.
-	nodes := 0
-	// Return an eval if the game is over.
-
+// ply is the distance from the root of the search, and st collects
+// statistics about the search.
+func (en *Engine) AlphaBetaSearch(b *game.Board, depth, ply int, alpha, beta float64, nullMove bool, c game.Color, st *Stats) (float64, game.EfficientMove) {
+	// Give up right away if the search has been stopped. Whatever we return
+	// here is discarded by the caller.
+	if en.shouldStop() {
+		return 0.0, game.EfficientMove(0)
+	}
 	// Evaluate any leaf nodes.
-	if (depth <= 0) {
-		return QuiescenceSearch(b, e, MAX_QUIESCENCE_DEPTH, alpha, beta) // Only store values if they are better values than we've seen before.  
+	if depth <= 0 {
+		return en.QuiescenceSearch(b, MAX_QUIESCENCE_DEPTH, ply, alpha, beta, st)
 	}
-
-	lm := b.AllLegalMoves()
-	over, winner := b.CalculateGameOver(lm)
-	if over {
-		if winner == 0 {
-			return 0.0, game.EfficientMove(0), 1
-		} else {
-			return math.Inf(-1), game.EfficientMove(0), 1
-		}
+	st.Nodes++
+	if ply > st.SelDepth {
+		st.SelDepth = ply
+	}
+	// Repeating a position within the search is a draw.
+	if ply > 0 && b.IsRepetition(ply) {
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
+	}
+	if isRuleDraw(b) {
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
+	}
+	// Checkmate and stalemate are found below, once we know we have no
+	// moves.
+	if ply >= MAX_PLY {
+		return en.Evaluator.Evaluate(b), game.EfficientMove(0)
 	}
 	// Store original values for transposition table to assess exact matches.
 	alphaOrig := alpha
 
 	// Check extensions.
-	if game.IsCheck(b, b.Active) {
+	inCheck := game.IsCheck(b, b.Active)
+	if inCheck {
 		depth = depth + 1
 	}
 	// Check the transposition table for work we've already done, and either
 	// return or update our cutoffs.
-	h := game.ZobristHash(b)
-	if entry, ok := game.TranspositionTable[h]; ok && (entry.Depth >= depth) && entry.Position == b.Position {
-		// Mark this entry to not be deleted.
-		entry.Ancient = false
-		game.TranspositionTable[h] = entry
-		switch entry.Precision {
-		case game.EvalExact:
-			return entry.Eval, entry.BestMove, 1
-		case game.EvalLowerBound:
-			if entry.Eval > alpha {
-				alpha = entry.Eval
+	h := b.Hash
+	st.TTProbes++
+	hashMove := game.EfficientMove(0)
+	if entry, ok := en.TT.Probe(h); ok {
+		st.TTHits++
+		// Make sure a hash collision didn't give us an illegal move.
+		hashMove = b.LegalMove(entry.BestMove)
+		if entry.Depth >= depth {
+			move := hashMove
+			switch entry.Precision {
+			case game.EvalExact:
+				st.TTCutoffs++
+				return entry.Eval, move
+			case game.EvalLowerBound:
+				if entry.Eval > alpha {
+					alpha = entry.Eval
+				}
+			case game.EvalUpperBound:
+				if entry.Eval < beta {
+					beta = entry.Eval
+				}
 			}
-		case game.EvalUpperBound:
-			if entry.Eval < beta {
-				beta = entry.Eval
+			if alpha >= beta {
+				st.TTCutoffs++
+				return entry.Eval, move
 			}
 		}
-		if alpha >= beta {
-			return entry.Eval, entry.BestMove, 1
-		}
 	}
 
 	// TODO(slisenberger): I'd like to eventually ignore book moves, seeing if we can do decent
@@ -69,56 +86,62 @@ func AlphaBetaSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta flo
 	//		return 0.0, bm
 	//	}
 
-
-
 	var best game.EfficientMove
 	var eval float64
-	var moves []game.EfficientMove
 
 	// Try a null move first. If we can prune the search tree without
 	// moving, we should. We also identify threats in the position this way.
-	if nullMove && !game.IsCheck(b, c) {
+	if nullMove && !inCheck {
+		st.NullMoveTries++
 		// NullMoves affect en passant state, so we need to remember it.
 		epSquare := b.EPSquare
-		b.EPSquare = game.OFFBOARD_SQUARE
-		var n int
-	        b.SwitchActivePlayer()	
-		eval, _, n = AlphaBetaSearch(b, e, depth-1-NULL_MOVE_REDUCED_SEARCH_DEPTH, -beta, -alpha, false, -c, km)
+		b.SetEPSquare(game.OFFBOARD_SQUARE)
+		b.SwitchActivePlayer()
+		eval, _ = en.AlphaBetaSearch(b, depth-1-NULL_MOVE_REDUCED_SEARCH_DEPTH, ply+1, -beta, -alpha, false, -c, st)
 		// negamax
 		eval = -1 * eval
-	        b.SwitchActivePlayer()	
-		b.EPSquare = epSquare
+		b.SwitchActivePlayer()
+		b.SetEPSquare(epSquare)
+		if en.Stopped() {
+			return 0.0, game.EfficientMove(0)
+		}
 		if eval >= beta {
-			return eval, game.EfficientMove(0), nodes + n
+			st.NullMoveCutoffs++
+			return eval, game.EfficientMove(0)
 		}
 	}
 
-	moves = game.OrderMoves(b, lm, depth, km, false)
+	picker := &en.pickers[ply]
+	picker.Init(b, hashMove, en.killers.GetKillerMoves(depth), en.history)
 	bestVal := math.Inf(-1)
-	for i := 0; i < len(moves); i++ {
-		move := moves[i]
+	i := 0
+	for move := picker.Next(); move != game.EfficientMove(0); move, i = picker.Next(), i+1 {
+		reduced := false
 		// Late Move Reductions. Trim the search space for later moves in our ordering scheme if they are quiet.
-		if (i >= 3) && (depth > 3) && move.Capture() == game.NULLPIECE && !game.IsCheck(b, b.Active) && move.Promotion() == game.NULLPIECE {
+		if (i >= 3) && (depth > 3) && move.Capture() == game.NULLPIECE && !inCheck && move.Promotion() == game.NULLPIECE {
 			// Also exclude moves that give check from reductions.
-			// Need a faster way to check if moves are checking moves.
-			bs := game.ApplyMove(b, move)
-			if !game.IsCheck(b, c * -1) {
+			if !picker.GivesCheck(move) {
 				depth = depth - 1
+				reduced = true
+				st.LMRReductions++
 			}
-			game.UndoMove(b, move, bs)
-
 		}
 
-		bs := game.ApplyMove(b, move)
-		b.SwitchActivePlayer()
+		child, bs := en.play(b, move, ply)
 		// Temporarily turn off null move reductions.
-		eval, _, n := AlphaBetaSearch(b, e, depth-1, -beta, -alpha, false, -c, km)
+		eval, _ := en.AlphaBetaSearch(child, depth-1, ply+1, -beta, -alpha, false, -c, st)
 		// Negate eval -- it's opponent's opinion!
 		eval = -1 * eval
-		// Undo move and restore player.
-		game.UndoMove(b, move, bs)
-	        b.SwitchActivePlayer()
-		nodes += n
+		en.unplay(b, move, bs)
+		// A stopped search returns the best of the moves it finished, and
+		// doesn't pollute the transposition table with partial results.
+		if en.Stopped() {
+			return bestVal, best
+		}
+		// A reduction pays off when the move turns out as bad as we guessed.
+		if reduced && eval <= alpha {
+			st.LMRSuccesses++
+		}
 		// We do >= because if checkmate is inevitable, we still need to pick a move.
 		if eval >= bestVal {
 			bestVal = eval
@@ -128,17 +151,28 @@ func AlphaBetaSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta flo
 			alpha = eval
 		}
 		if alpha >= beta {
+			st.BetaCutoffs++
+			if i == 0 {
+				st.FirstMoveCutoffs++
+			}
 			// Non captures that cause beta cutoffs should be tried
 			// earlier in sooner iterations.
 			if move.Capture() == game.NULLPIECE {
-				km.AddKillerMove(depth, move)
-		        }
+				en.killers.AddKillerMove(depth, move)
+				en.history.AddCutoff(move, depth)
+			}
 			break
 		}
 	}
+	// With no legal moves, the game is over.
+	if best == game.EfficientMove(0) {
+		if inCheck {
+			return math.Inf(-1), game.EfficientMove(0)
+		}
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
+	}
 	// Store values in transposition table.
-	hash := game.ZobristHash(b)
-	entry := game.TTEntry{Depth: depth, Eval: bestVal, BestMove: best, Ancient: false, Position: b.Position}
+	entry := game.TTEntry{Depth: depth, Eval: bestVal, BestMove: best.Compact()}
 	if bestVal <= alphaOrig {
 		entry.Precision = game.EvalUpperBound
 	} else if bestVal >= beta {
@@ -146,48 +180,95 @@ func AlphaBetaSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta flo
 	} else {
 		entry.Precision = game.EvalExact
 	}
+	en.TT.Store(h, entry)
 
-	// Only store values if they are better values than we've seen before, or if
-	// no values have been stored, or if a collission.
-//	old, ok := game.TranspositionTable[hash]
-//	if !ok || (old.Depth < depth) || old.Position != b.Position {
-		game.TranspositionTable[hash] = entry
-//	}
-
-	return bestVal, best, nodes
+	return bestVal, best
 }
 
-func QuiescenceSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta float64) (float64, game.EfficientMove, int){
-	// The number of nodes searched.
-	nodes := 0
+// play makes move on b, at ply plies from the root, and returns the board
+// to search next, with the opponent to move. In copy-make searches that's
+// a copy kept for the next ply and b is left alone; otherwise it's b
+// itself, and unplay has to take the move back.
+func (en *Engine) play(b *game.Board, move game.EfficientMove, ply int) (*game.Board, game.BoardState) {
+	if en.CopyMake {
+		child := &en.boards[ply+1]
+		b.CopyMake(child, move)
+		return child, game.BoardState{}
+	}
+	bs := game.ApplyMove(b, move)
+	b.SwitchActivePlayer()
+	return b, bs
+}
 
-	var moves []game.EfficientMove
+// unplay takes back a move made by play.
+func (en *Engine) unplay(b *game.Board, move game.EfficientMove, bs game.BoardState) {
+	if en.CopyMake {
+		return
+	}
+	game.UndoMove(b, move, bs)
+	b.SwitchActivePlayer()
+}
 
-	// Else, quiescence search only searches legal captures and checks, or check evasions
+// isRuleDraw returns true if the position is drawn by the fifty move rule
+// or for lack of mating material. Checkmate takes precedence over the fifty
+// move rule.
+func isRuleDraw(b *game.Board) bool {
+	if b.IsInsufficientMaterial() {
+		return true
+	}
+	return b.IsFiftyMoveDraw() && (!game.IsCheck(b, b.Active) || b.HasLegalMove())
+}
 
-	qmoves, allmoves := b.AllQuiescenceMoves()
+// DrawScore is the value of a draw to the side to move, ply moves into a
+// search. The side to move at the root loses contempt by drawing, and so
+// its opponent gains it.
+func DrawScore(ply int, contempt float64) float64 {
+	if ply%2 == 0 {
+		return -contempt
+	}
+	return contempt
+}
 
+func (en *Engine) QuiescenceSearch(b *game.Board, depth, ply int, alpha, beta float64, st *Stats) (float64, game.EfficientMove) {
+	if en.shouldStop() {
+		return 0.0, game.EfficientMove(0)
+	}
+	st.QNodes++
+	if ply > st.SelDepth {
+		st.SelDepth = ply
+	}
+	if ply > 0 && b.IsRepetition(ply) {
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
+	}
+	if isRuleDraw(b) {
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
+	}
+	if ply >= MAX_PLY {
+		return en.Evaluator.Evaluate(b), game.EfficientMove(0)
+	}
 
-	// Start by making sure the game is still playable
-	over, winner := b.CalculateGameOver(allmoves)
-	if over {
-		if winner == 0 {
-			return 0.0, game.EfficientMove(0), 1
-		} else {
-			return math.Inf(-1), game.EfficientMove(0), 1
+	// Quiescence search only searches legal captures and checks, or check
+	// evasions. Don't use the transposition table in quiescence search.
+	picker := &en.pickers[ply]
+	picker.InitQuiescence(b)
+	move := picker.Next()
+	// Start by making sure the game is still playable.
+	if move == game.EfficientMove(0) && (picker.InCheck() || !b.HasLegalMove()) {
+		if picker.InCheck() {
+			return math.Inf(-1), game.EfficientMove(0)
 		}
+		return DrawScore(ply, en.Contempt), game.EfficientMove(0)
 	}
-	moves = game.OrderMoves(b, qmoves, depth, nil, true)
 
 	// evaluate the position as a stand pat baseline
-	eval := e.Evaluate(b)
+	eval := en.Evaluator.Evaluate(b)
 	// Return normal evaluation from quiet boards at max depth.
-	if depth <= 0 || len(moves) == 0 {
-		return eval, game.EfficientMove(0), 1
+	if depth <= 0 || move == game.EfficientMove(0) {
+		return eval, game.EfficientMove(0)
 	}
 	// Otherwise, use stand pat value to optimize quiescence bounds.
 	if eval >= beta {
-		return eval, game.EfficientMove(0), 1
+		return eval, game.EfficientMove(0)
 	}
 	if eval > alpha {
 		alpha = eval
@@ -195,17 +276,16 @@ func QuiescenceSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta fl
 
 	var best game.EfficientMove
 	bestVal := math.Inf(-1)
-	for _, move := range moves {
+	for ; move != game.EfficientMove(0); move = picker.Next() {
 		var eval float64
-		bs := game.ApplyMove(b, move)
-		b.SwitchActivePlayer()
-		eval, _, n := QuiescenceSearch(b, e, depth-1, -beta, -alpha)
+		child, bs := en.play(b, move, ply)
+		eval, _ = en.QuiescenceSearch(child, depth-1, ply+1, -beta, -alpha, st)
 		// Negate eval -- it's opponent's opinion!
 		eval = -1 * eval
-		game.UndoMove(b, move, bs)
-	        b.SwitchActivePlayer()
-		nodes += n
-		// Undo move and restore player.
+		en.unplay(b, move, bs)
+		if en.Stopped() {
+			return bestVal, best
+		}
 		// We do >= because if checkmate is inevitable, we still need to pick a move.
 		if eval >= bestVal {
 			bestVal = eval
@@ -219,5 +299,5 @@ func QuiescenceSearch(b *game.Board, e game.Evaluator, depth int, alpha, beta fl
 		}
 	}
 
-	return bestVal, best, nodes
+	return bestVal, best
 }
@@ -2,6 +2,7 @@ package search
 
 import "math"
 import "testing"
+import "time"
 import "../../game"
 
 
@@ -70,7 +71,8 @@ func TestMate(t *testing.T) {
 	   if err != nil {
 		   t.Error("failed to read board from fen")
 	   }
-	   _, move, _ := AlphaBetaSearch(b, e, tc.depth, math.Inf(-1), math.Inf(1), false, b.Active, game.NewKillerMoves())
+	   en := NewEngine(e, 16)
+	   _, move := en.AlphaBetaSearch(b, tc.depth, 0, math.Inf(-1), math.Inf(1), false, b.Active, &Stats{})
 	   if move.String() != tc.move {
 		t.Errorf("Got wrong move for test %v. Want %v, got %v",tc.name, tc.move, move.String())
 		b.Print()
@@ -108,10 +110,86 @@ func TestMaterial(t *testing.T) {
 	   if err != nil {
 		   t.Error("failed to read board from fen")
 	   }
-	   eval, move, _ := AlphaBetaSearch(b, e, tc.depth, math.Inf(-1), math.Inf(1), false, b.Active, game.NewKillerMoves())
+	   en := NewEngine(e, 16)
+	   eval, move := en.AlphaBetaSearch(b, tc.depth, 0, math.Inf(-1), math.Inf(1), false, b.Active, &Stats{})
 	   if move.String() != tc.move {
 		t.Errorf("Got wrong move in test %v. Want %v, got %v (eval %v)", tc.name, tc.move,  move.String(), eval)
 		b.Print()
 	   }
         }
 }
+
+// Test that a search with a deadline gives up when time runs out.
+func TestDeadline(t *testing.T) {
+	game.InitInternalData()
+	b := game.DefaultBoard()
+	en := NewEngine(game.MaterialEvaluator{}, 16)
+	en.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	start := time.Now()
+	en.AlphaBetaSearch(b, 20, 0, math.Inf(-1), math.Inf(1), false, b.Active, &Stats{})
+	if !en.Stopped() {
+		t.Errorf("search to depth 20 finished before its deadline")
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("search took %v to stop after a 100ms deadline", took)
+	}
+	if b.Position != game.DefaultBoard().Position {
+		t.Errorf("stopped search did not restore the board")
+	}
+}
+
+// Test that search statistics are collected and self-consistent.
+func TestStats(t *testing.T) {
+	game.InitInternalData()
+	b := game.DefaultBoard()
+	en := NewEngine(game.MaterialEvaluator{}, 16)
+	st := Stats{}
+	en.AlphaBetaSearch(b, 3, 0, math.Inf(-1), math.Inf(1), false, b.Active, &st)
+	if st.Nodes == 0 || st.QNodes == 0 {
+		t.Errorf("search counted no nodes: %v", st)
+	}
+	if st.SelDepth < 3 {
+		t.Errorf("selective depth %v is less than the search depth 3", st.SelDepth)
+	}
+	if st.TTHits > st.TTProbes || st.TTCutoffs > st.TTHits {
+		t.Errorf("transposition table counters are inconsistent: %v", st)
+	}
+	if st.BetaCutoffs == 0 || st.FirstMoveCutoffs > st.BetaCutoffs {
+		t.Errorf("beta cutoff counters are inconsistent: %v", st)
+	}
+}
+
+// Test that contempt makes the engine avoid draws it would otherwise take.
+func TestContempt(t *testing.T) {
+	game.InitInternalData()
+	// Taking the pawn leaves a knight that can't mate on its own.
+	fen := "n6k/8/8/3p4/4K3/8/8/8 w - - 0 1"
+	testCases := []struct {
+		name     string
+		contempt float64
+		draw     bool // Whether we want to take the draw.
+	}{
+		{
+			name:     "no contempt takes the draw when losing",
+			contempt: 0,
+			draw:     true,
+		}, {
+			name:     "high contempt avoids the draw",
+			contempt: 5,
+			draw:     false,
+		},
+	}
+	e := game.MaterialEvaluator{}
+	for _, tc := range testCases {
+		b, err := game.BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("failed to read board from fen: %v", err)
+		}
+		en := NewEngine(e, 16)
+		en.Contempt = tc.contempt
+		_, move := en.AlphaBetaSearch(b, 1, 0, math.Inf(-1), math.Inf(1), false, b.Active, &Stats{})
+		if got := move.String() == "Ke4xd5"; got != tc.draw {
+			t.Errorf("%v: got move %v", tc.name, move)
+		}
+	}
+}
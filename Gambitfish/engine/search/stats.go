@@ -0,0 +1,88 @@
+// stats.go collects measurements of a search, so that changes to the
+// search can be compared objectively.
+package search
+
+import "fmt"
+import "time"
+
+// Stats are counters accumulated over a search.
+type Stats struct {
+	Nodes    int           // Nodes visited by AlphaBetaSearch.
+	QNodes   int           // Nodes visited by QuiescenceSearch.
+	SelDepth int           // The deepest ply reached, including quiescence.
+	Time     time.Duration // How long the search took. Set by the caller.
+
+	TTProbes  int // Transposition table lookups.
+	TTHits    int // Lookups that found an entry for this position.
+	TTCutoffs int // Hits that let us return without searching.
+
+	BetaCutoffs      int // Nodes where a move failed high.
+	FirstMoveCutoffs int // Beta cutoffs caused by the first move we tried.
+
+	NullMoveTries   int // Null moves searched.
+	NullMoveCutoffs int // Null moves that failed high.
+
+	LMRReductions int // Moves searched at a reduced depth.
+	LMRSuccesses  int // Reduced moves that failed low, as we guessed.
+}
+
+// AllNodes returns the total number of nodes visited, including quiescence.
+func (s *Stats) AllNodes() int {
+	return s.Nodes + s.QNodes
+}
+
+// NPS returns the number of nodes searched per second.
+func (s *Stats) NPS() float64 {
+	if s.Time <= 0 {
+		return 0
+	}
+	return float64(s.AllNodes()) / s.Time.Seconds()
+}
+
+// FirstMoveCutoffRate returns the fraction of beta cutoffs that came from
+// the first move searched. It is a measure of how good move ordering is.
+func (s *Stats) FirstMoveCutoffRate() float64 {
+	return ratio(s.FirstMoveCutoffs, s.BetaCutoffs)
+}
+
+// TTHitRate returns the fraction of transposition table probes that hit.
+func (s *Stats) TTHitRate() float64 {
+	return ratio(s.TTHits, s.TTProbes)
+}
+
+// Add accumulates the counters from o into s. SelDepth becomes the deeper of
+// the two.
+func (s *Stats) Add(o Stats) {
+	s.Nodes += o.Nodes
+	s.QNodes += o.QNodes
+	if o.SelDepth > s.SelDepth {
+		s.SelDepth = o.SelDepth
+	}
+	s.Time += o.Time
+	s.TTProbes += o.TTProbes
+	s.TTHits += o.TTHits
+	s.TTCutoffs += o.TTCutoffs
+	s.BetaCutoffs += o.BetaCutoffs
+	s.FirstMoveCutoffs += o.FirstMoveCutoffs
+	s.NullMoveTries += o.NullMoveTries
+	s.NullMoveCutoffs += o.NullMoveCutoffs
+	s.LMRReductions += o.LMRReductions
+	s.LMRSuccesses += o.LMRSuccesses
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("nodes %v (%v quiescence) seldepth %v time %v nps %.0f | tt probes %v hits %.1f%% cutoffs %v | "+
+		"beta cutoffs %v first move %.1f%% | null move %v/%v | lmr %v/%v",
+		s.AllNodes(), s.QNodes, s.SelDepth, s.Time, s.NPS(),
+		s.TTProbes, 100*s.TTHitRate(), s.TTCutoffs,
+		s.BetaCutoffs, 100*s.FirstMoveCutoffRate(),
+		s.NullMoveCutoffs, s.NullMoveTries,
+		s.LMRSuccesses, s.LMRReductions)
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
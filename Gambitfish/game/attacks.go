@@ -0,0 +1,122 @@
+// attacks.go answers questions about who attacks what, from the magic
+// bitboard tables and the BETWEEN and LINE tables. It's meant for move
+// generation, static exchange evaluation and evaluation terms that need
+// attacks on a few squares, without building whole attack maps.
+package game
+
+import "math/bits"
+
+// BishopAttacks returns the squares a bishop on s attacks, if the occupied
+// squares were occ.
+func BishopAttacks(s Square, occ uint64) uint64 {
+	m := &BISHOPMAGICS[s]
+	return SLIDERATTACKS[m.Offset+m.Index(occ)]
+}
+
+// RookAttacks returns the squares a rook on s attacks, if the occupied
+// squares were occ.
+func RookAttacks(s Square, occ uint64) uint64 {
+	m := &ROOKMAGICS[s]
+	return SLIDERATTACKS[m.Offset+m.Index(occ)]
+}
+
+// QueenAttacks returns the squares a queen on s attacks, if the occupied
+// squares were occ.
+func QueenAttacks(s Square, occ uint64) uint64 {
+	return BishopAttacks(s, occ) | RookAttacks(s, occ)
+}
+
+// XrayBishopAttacks returns the squares a bishop on s would attack through
+// the first of blockers in each direction, and not without it. With our
+// own pieces as blockers, that's where a battery behind them reaches.
+func XrayBishopAttacks(s Square, occ, blockers uint64) uint64 {
+	atk := BishopAttacks(s, occ)
+	blockers &= atk
+	return atk ^ BishopAttacks(s, occ^blockers)
+}
+
+// XrayRookAttacks is XrayBishopAttacks for a rook.
+func XrayRookAttacks(s Square, occ, blockers uint64) uint64 {
+	atk := RookAttacks(s, occ)
+	blockers &= atk
+	return atk ^ RookAttacks(s, occ^blockers)
+}
+
+// AttackersTo returns the pieces of color c that attack square s, if the
+// occupied squares were occ. Passing an occupancy with pieces taken away
+// reveals the sliders behind them, as exchanges on s do.
+func AttackersTo(b *Board, s Square, occ uint64, c Color) uint64 {
+	pos := &b.Position
+	switch c {
+	case WHITE:
+		return BLACKPAWNATTACKS[s]&pos.WhitePawns |
+			LEGALKNIGHTMOVES[s]&pos.WhiteKnights |
+			LEGALKINGMOVES[s]&pos.WhiteKing |
+			BishopAttacks(s, occ)&(pos.WhiteBishops|pos.WhiteQueens) |
+			RookAttacks(s, occ)&(pos.WhiteRooks|pos.WhiteQueens)
+	case BLACK:
+		return WHITEPAWNATTACKS[s]&pos.BlackPawns |
+			LEGALKNIGHTMOVES[s]&pos.BlackKnights |
+			LEGALKINGMOVES[s]&pos.BlackKing |
+			BishopAttacks(s, occ)&(pos.BlackBishops|pos.BlackQueens) |
+			RookAttacks(s, occ)&(pos.BlackRooks|pos.BlackQueens)
+	}
+	return 0
+}
+
+// AllAttackersTo returns the pieces of both colors that attack square s,
+// if the occupied squares were occ.
+func AllAttackersTo(b *Board, s Square, occ uint64) uint64 {
+	return AttackersTo(b, s, occ, WHITE) | AttackersTo(b, s, occ, BLACK)
+}
+
+// Pins returns the pieces of color c pinned to their king, which can only
+// move along the line between the king and the pinner, and the enemy
+// sliders pinning them. Both are empty if c has no king.
+func Pins(b *Board, c Color) (pinned, pinners uint64) {
+	pos := &b.Position
+	var king, own, rooks, bishops uint64
+	switch c {
+	case WHITE:
+		king, own = pos.WhiteKing, pos.WhitePieces
+		rooks = pos.BlackRooks | pos.BlackQueens
+		bishops = pos.BlackBishops | pos.BlackQueens
+	case BLACK:
+		king, own = pos.BlackKing, pos.BlackPieces
+		rooks = pos.WhiteRooks | pos.WhiteQueens
+		bishops = pos.WhiteBishops | pos.WhiteQueens
+	}
+	if king == 0 {
+		return 0, 0
+	}
+	ks := Square(bits.TrailingZeros64(king))
+	snipers := RookAttacks(ks, 0)&rooks | BishopAttacks(ks, 0)&bishops
+	for ; snipers != 0; snipers &= snipers - 1 {
+		sniper := bits.TrailingZeros64(snipers)
+		blockers := BETWEEN[ks][sniper] & pos.Occupied
+		if blockers != 0 && blockers&(blockers-1) == 0 && blockers&own != 0 {
+			pinned |= blockers
+			pinners |= 1 << uint(sniper)
+		}
+	}
+	return pinned, pinners
+}
+
+// Aligned returns true if the three squares are on one rank, file or
+// diagonal.
+func Aligned(a, b, c Square) bool {
+	return LINE[a][b]&(1<<uint(c)) != 0
+}
+
+// singleBlockers returns the pieces that are alone between a sniper and
+// the king's square, of either color.
+func singleBlockers(king Square, snipers, occ uint64) uint64 {
+	var res uint64
+	for ; snipers != 0; snipers &= snipers - 1 {
+		blockers := BETWEEN[king][bits.TrailingZeros64(snipers)] & occ
+		if blockers != 0 && blockers&(blockers-1) == 0 {
+			res |= blockers
+		}
+	}
+	return res
+}
@@ -0,0 +1,144 @@
+package game
+
+import "testing"
+
+// Test that AttackersTo finds every piece whose attacks reach a square,
+// and that the squares with attackers make up GetAttackBitboard.
+func TestAttackersTo(t *testing.T) {
+	InitInternalData()
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	for _, fen := range fens {
+		b, err := BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("error reading fen string %v: %v", fen, err)
+		}
+		for _, c := range []Color{WHITE, BLACK} {
+			var attacked uint64
+			for s := Square(0); s < 64; s++ {
+				var want uint64
+				for from, p := range b.Squares {
+					if p != NULLPIECE && p.Color() == c && AttackBitboard(b, p, Square(from))&(1<<uint(s)) != 0 {
+						want |= 1 << uint(from)
+					}
+				}
+				if got := AttackersTo(b, s, b.Position.Occupied, c); got != want {
+					t.Errorf("%v: attackers of %v to %v: got %v, want %v", fen, c, s, SquaresFromBitBoard(got), SquaresFromBitBoard(want))
+				}
+				if want != 0 {
+					attacked |= 1 << uint(s)
+				}
+			}
+			if got := GetAttackBitboard(b, c); got != attacked {
+				t.Errorf("%v: squares attacked by %v: got %v, want %v", fen, c, SquaresFromBitBoard(got), SquaresFromBitBoard(attacked))
+			}
+		}
+	}
+}
+
+func TestPins(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name    string
+		fen     string
+		c       Color
+		pinned  []Square
+		pinners []Square
+	}{
+		{
+			name: "no pins at the start",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			c:    WHITE,
+		}, {
+			name:    "bishop pins a knight",
+			fen:     "rnbqk1nr/pppp1ppp/8/4p3/1b6/2NP4/PPP1PPPP/R1BQKBNR w KQkq - 0 1",
+			c:       WHITE,
+			pinned:  []Square{C3},
+			pinners: []Square{B4},
+		}, {
+			name: "two pieces in the way aren't pinned",
+			fen:  "4k3/8/8/8/4r3/8/4N3/4K3 w - - 0 1",
+			c:    BLACK,
+		}, {
+			name: "enemy pieces in the way aren't pinned",
+			fen:  "4k3/4n3/8/8/4R3/8/4P3/4K3 w - - 0 1",
+			c:    WHITE,
+		}, {
+			name:    "a rook pins, a bishop off the diagonal doesn't",
+			fen:     "4k3/4n3/8/B7/4R3/8/8/4K3 w - - 0 1",
+			c:       BLACK,
+			pinned:  []Square{E7},
+			pinners: []Square{E4},
+		},
+	}
+	bitboard := func(squares []Square) uint64 {
+		var bb uint64
+		for _, s := range squares {
+			bb |= 1 << uint(s)
+		}
+		return bb
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.fen, err)
+		}
+		pinned, pinners := Pins(b, tc.c)
+		if pinned != bitboard(tc.pinned) {
+			t.Errorf("%v: got pinned %v, want %v", tc.name, SquaresFromBitBoard(pinned), tc.pinned)
+		}
+		if pinners != bitboard(tc.pinners) {
+			t.Errorf("%v: got pinners %v, want %v", tc.name, SquaresFromBitBoard(pinners), tc.pinners)
+		}
+	}
+}
+
+func TestXrayAttacks(t *testing.T) {
+	InitInternalData()
+	// A rook on a1 behind a rook on a3, with a pawn on a6, and a bishop on
+	// c1 behind a queen on e3, with nothing beyond.
+	occ := uint64(1)<<A1 | 1<<A3 | 1<<A6 | 1<<C1 | 1<<E3
+	if got, want := XrayRookAttacks(A1, occ, 1<<A3), uint64(1)<<A4|1<<A5|1<<A6; got != want {
+		t.Errorf("rook x-ray: got %v, want %v", SquaresFromBitBoard(got), SquaresFromBitBoard(want))
+	}
+	if got, want := XrayBishopAttacks(C1, occ, 1<<E3), uint64(1)<<F4|1<<G5|1<<H6; got != want {
+		t.Errorf("bishop x-ray: got %v, want %v", SquaresFromBitBoard(got), SquaresFromBitBoard(want))
+	}
+	if got := XrayRookAttacks(A1, occ, 0); got != 0 {
+		t.Errorf("rook x-ray with no blockers: got %v, want none", SquaresFromBitBoard(got))
+	}
+}
+
+func TestAligned(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		a, b, c Square
+		want    bool
+	}{
+		{A1, H8, D4, true},
+		{A1, D4, H8, true},
+		{E1, E8, E4, true},
+		{A1, H8, D5, false},
+		{B1, C3, D5, false},
+	}
+	for _, tc := range testCases {
+		if got := Aligned(tc.a, tc.b, tc.c); got != tc.want {
+			t.Errorf("Aligned(%v, %v, %v): got %v, want %v", tc.a, tc.b, tc.c, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkGetAttackBitboard(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GetAttackBitboard(board, WHITE)
+	}
+}
@@ -27,6 +27,9 @@ type Position struct {
 	Occupied    uint64
 }
 
+// UpdateBitboards recomputes the color and occupancy bitboards from the
+// piece bitboards. Put and Remove keep them up to date as they go, so this
+// is only needed for a Position built some other way.
 func UpdateBitboards(bb Position) Position {
 	bb.WhitePieces = bb.WhiteKing | bb.WhiteQueens | bb.WhiteRooks | bb.WhiteKnights | bb.WhiteBishops | bb.WhitePawns
 	bb.BlackPieces = bb.BlackKing | bb.BlackQueens | bb.BlackRooks | bb.BlackKnights | bb.BlackBishops | bb.BlackPawns
@@ -34,89 +37,60 @@ func UpdateBitboards(bb Position) Position {
 	return bb
 }
 
-// SetPiece updates a bitboard to move a piece to a given square.
-func SetPiece(bb Position, p Piece, s Square) Position {
-	switch p.Type() {
-	case KING:
-		if p.Color() == WHITE {
-			bb.WhiteKing = SetBitOnBoard(bb.WhiteKing, s)
-		} else {
-			bb.BlackKing = SetBitOnBoard(bb.BlackKing, s)
-		}
-	case QUEEN:
-		if p.Color() == WHITE {
-			bb.WhiteQueens = SetBitOnBoard(bb.WhiteQueens, s)
-		} else {
-			bb.BlackQueens = SetBitOnBoard(bb.BlackQueens, s)
-		}
-	case ROOK:
-		if p.Color() == WHITE {
-			bb.WhiteRooks = SetBitOnBoard(bb.WhiteRooks, s)
-		} else {
-			bb.BlackRooks = SetBitOnBoard(bb.BlackRooks, s)
-		}
-	case BISHOP:
-		if p.Color() == WHITE {
-			bb.WhiteBishops = SetBitOnBoard(bb.WhiteBishops, s)
-		} else {
-			bb.BlackBishops = SetBitOnBoard(bb.BlackBishops, s)
-		}
-	case KNIGHT:
-		if p.Color() == WHITE {
-			bb.WhiteKnights = SetBitOnBoard(bb.WhiteKnights, s)
-		} else {
-			bb.BlackKnights = SetBitOnBoard(bb.BlackKnights, s)
-		}
-	case PAWN:
-		if p.Color() == WHITE {
-			bb.WhitePawns = SetBitOnBoard(bb.WhitePawns, s)
-		} else {
-			bb.BlackPawns = SetBitOnBoard(bb.BlackPawns, s)
-		}
+// PieceBoard returns the bitboard holding the pieces of kind p, or nil
+// for NULLPIECE.
+func (pos *Position) PieceBoard(p Piece) *uint64 {
+	switch p {
+	case WHITEKING:
+		return &pos.WhiteKing
+	case WHITEQUEEN:
+		return &pos.WhiteQueens
+	case WHITEROOK:
+		return &pos.WhiteRooks
+	case WHITEBISHOP:
+		return &pos.WhiteBishops
+	case WHITEKNIGHT:
+		return &pos.WhiteKnights
+	case WHITEPAWN:
+		return &pos.WhitePawns
+	case BLACKKING:
+		return &pos.BlackKing
+	case BLACKQUEEN:
+		return &pos.BlackQueens
+	case BLACKROOK:
+		return &pos.BlackRooks
+	case BLACKBISHOP:
+		return &pos.BlackBishops
+	case BLACKKNIGHT:
+		return &pos.BlackKnights
+	case BLACKPAWN:
+		return &pos.BlackPawns
 	}
-	return bb
+	return nil
 }
 
-func UnSetPiece(bb Position, p Piece, s Square) Position {
-	switch p.Type() {
-	case KING:
-		if p.Color() == WHITE {
-			bb.WhiteKing = UnSetBitOnBoard(bb.WhiteKing, s)
-		} else {
-			bb.BlackKing = UnSetBitOnBoard(bb.BlackKing, s)
-		}
-	case QUEEN:
-		if p.Color() == WHITE {
-			bb.WhiteQueens = UnSetBitOnBoard(bb.WhiteQueens, s)
-		} else {
-			bb.BlackQueens = UnSetBitOnBoard(bb.BlackQueens, s)
-		}
-	case ROOK:
-		if p.Color() == WHITE {
-			bb.WhiteRooks = UnSetBitOnBoard(bb.WhiteRooks, s)
-		} else {
-			bb.BlackRooks = UnSetBitOnBoard(bb.BlackRooks, s)
-		}
-	case BISHOP:
-		if p.Color() == WHITE {
-			bb.WhiteBishops = UnSetBitOnBoard(bb.WhiteBishops, s)
-		} else {
-			bb.BlackBishops = UnSetBitOnBoard(bb.BlackBishops, s)
-		}
-	case KNIGHT:
-		if p.Color() == WHITE {
-			bb.WhiteKnights = UnSetBitOnBoard(bb.WhiteKnights, s)
-		} else {
-			bb.BlackKnights = UnSetBitOnBoard(bb.BlackKnights, s)
-		}
-	case PAWN:
-		if p.Color() == WHITE {
-			bb.WhitePawns = UnSetBitOnBoard(bb.WhitePawns, s)
-		} else {
-			bb.BlackPawns = UnSetBitOnBoard(bb.BlackPawns, s)
-		}
+// colorBoard returns the bitboard holding all of c's pieces.
+func (pos *Position) colorBoard(c Color) *uint64 {
+	if c == WHITE {
+		return &pos.WhitePieces
 	}
-	return bb
+	return &pos.BlackPieces
+}
+
+// Put adds p to the empty square s.
+func (pos *Position) Put(p Piece, s Square) {
+	bb := uint64(1) << uint(s)
+	*pos.PieceBoard(p) |= bb
+	*pos.colorBoard(p.Color()) |= bb
+	pos.Occupied |= bb
+}
+
+// Remove takes p off s.
+func (pos *Position) Remove(p Piece, s Square) {
+	bb := uint64(1) << uint(s)
+	*pos.PieceBoard(p) &^= bb
+	*pos.colorBoard(p.Color()) &^= bb
+	pos.Occupied &^= bb
 }
 
 // SetBitOnBoard updates a single 64 bit int with a newly set bit.
@@ -130,67 +104,33 @@ func UnSetBitOnBoard(board uint64, s Square) uint64 {
 }
 
 // SquaresFromBitBoard returns a list of squares represented by the bits
-// in a bitboard.
-func SquaresFromBitBoard(board uint64) []Square { // Split the board into 8 2byte words, and get the precomputed squares from all
-	// 4 of these byte patterns.
-	var b1, b2, b3, b4 uint64
-	b1 = board & 0xffff
-	b2 = board & 0xffff0000
-	b3 = board & 0xffff00000000
-	b4 = board & 0xffff000000000000
-
-	// Build a slice and add the elements to it.
+// in a bitboard. It allocates, so code that only needs to visit each
+// square should loop with PopLSB instead.
+func SquaresFromBitBoard(board uint64) []Square {
 	s := make([]Square, 0, bits.OnesCount64(board))
-	if b1 != 0 {
-		s = append(s, byteLookup[b1]...)
+	for board != 0 {
+		s = append(s, PopLSB(&board))
 	}
-	if b2 != 0 {
-		s = append(s, byteLookup[b2]...)
-	}
-	if b3 != 0 {
-		s = append(s, byteLookup[b3]...)
-	}
-	if b4 != 0 {
-		s = append(s, byteLookup[b4]...)
-	}
-	// This is the old way. Keeping it for posterity.
-	//	for board > 0 {
-	//		idx := BitScanForward(board)
-	//		s = append(s, idx)
-	//		board = board & (board - 1)
-	//	}
 	return s
 }
 
-// To speed up turning a bitboard into a list of squares, we look up pre-existing conversions of
-// bytes to a list of squares.
-var byteLookup map[uint64][]Square
-
-func BuildByteLookupTable() {
-	// We want to build a lookup table for each 2-byte word and
-	// the corresponding squares that belongs to it. We can do this by
-	// enumerating each word, running a slow calculation, and then adding
-	// these to the map.
-	byteLookup = map[uint64][]Square{}
+// PopLSB removes the lowest set bit from *board and returns its square.
+// It's the way to visit every square of a bitboard without allocating:
+//
+//	for bb := b.Position.WhiteKnights; bb != 0; {
+//		s := PopLSB(&bb)
+//		...
+//	}
+func PopLSB(board *uint64) Square {
+	s := Square(bits.TrailingZeros64(*board))
+	*board &= *board - 1
+	return s
+}
 
-	// For each of 8 possible byte-sized words.
-	var i uint64
-	var b_conf uint64
-	var b uint64
-	for i = 0; i < 4; i++ {
-		// Take the byte configuration pattern and build the two byte word out of it.
-		for b_conf = 0; b_conf < 65536; b_conf++ {
-			// bitshift it to represent the real byte affected.
-			b = b_conf << (16 * i)
-			s := []Square{}
-			for b > 0 {
-				idx := BitScanForward(b)
-				s = append(s, idx)
-				b = b & (b - 1)
-			}
-			byteLookup[b_conf<<(16*i)] = s
-		}
-	}
+// LSB returns the square of the lowest set bit of a bitboard, which must
+// not be empty.
+func LSB(board uint64) Square {
+	return Square(bits.TrailingZeros64(board))
 }
 
 // BITSCAN UTILITIES
@@ -71,3 +71,23 @@ func TestSetBitOnBoard(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkSquaresFromBitBoard(b *testing.B) {
+	InitInternalData()
+	board := DefaultBoard().Position.Occupied
+	for i := 0; i < b.N; i++ {
+		for _, s := range SquaresFromBitBoard(board) {
+			_ = s
+		}
+	}
+}
+
+func BenchmarkPopLSB(b *testing.B) {
+	InitInternalData()
+	board := DefaultBoard().Position.Occupied
+	for i := 0; i < b.N; i++ {
+		for bb := board; bb != 0; {
+			_ = PopLSB(&bb)
+		}
+	}
+}
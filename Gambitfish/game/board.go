@@ -2,8 +2,14 @@
 package game
 
 import "fmt"
+import "math/bits"
 
 type Board struct {
+	// Position holds the pieces as bitboards, which are what move
+	// generation and evaluation work from. Squares is a mailbox of the same
+	// pieces, for finding what's on a square without searching every
+	// bitboard. Both are changed together by put and remove, and never
+	// directly.
 	Squares     [64]Piece
 	Position    Position
 	Active      Color
@@ -15,8 +21,24 @@ type Board struct {
 	Move        int
 	LastMove    EfficientMove
 	EPSquare    Square // The square a pawn was just pushed two forward.
-	AllMoves    []EfficientMove
-	History     []Position
+	// HalfMoveClock is the number of plies since the last capture or pawn
+	// move, for the fifty-move rule.
+	HalfMoveClock int
+	// AllMoves is the moves made with Push, in order.
+	AllMoves []EfficientMove
+	// Keys is a stack of the zobrist hashes of every position reached in
+	// the game, ending with the current one.
+	Keys []uint64
+	// Hash is the zobrist hash of the board, kept up to date by ApplyMove,
+	// UndoMove and SwitchActivePlayer so that it never has to be computed
+	// from scratch.
+	Hash uint64
+	// PawnHash is the zobrist hash of just the pawns and kings, for looking
+	// up the pawn structure in a PawnTable.
+	PawnHash uint64
+
+	// states holds what Pop needs to take back each move in AllMoves.
+	states []BoardState
 }
 
 type BoardState struct {
@@ -26,53 +48,56 @@ type BoardState struct {
 	BKSCastling bool
 	BQSCastling bool
 	EPSquare    Square // The square a pawn was just pushed two forward.
+	Move          int
+	HalfMoveClock int
+	Hash          uint64
+	PawnHash      uint64
 }
 
+// FIFTY_MOVE_RULE_PLIES is the number of plies without a capture or pawn
+// move after which the game is drawn.
+const FIFTY_MOVE_RULE_PLIES = 100
+
 func DefaultBoard() *Board {
 	b := &Board{Active: WHITE}
 	// Add pawns
 	for i := 1; i <= 8; i++ {
 		blackPawnSquare := GetSquare(7, i)
 		whitePawnSquare := GetSquare(2, i)
-		b.Squares[blackPawnSquare] = BLACKPAWN
+		b.put(BLACKPAWN, blackPawnSquare)
 
-		b.Squares[whitePawnSquare] = WHITEPAWN
+		b.put(WHITEPAWN, whitePawnSquare)
 	}
 	// Add rooks.
-	b.Squares[0] = WHITEROOK
-	b.Squares[7] = WHITEROOK
-	b.Squares[56] = BLACKROOK
-	b.Squares[63] = BLACKROOK
+	b.put(WHITEROOK, 0)
+	b.put(WHITEROOK, 7)
+	b.put(BLACKROOK, 56)
+	b.put(BLACKROOK, 63)
 	// Add &Knights.
-	b.Squares[1] = WHITEKNIGHT
-	b.Squares[6] = WHITEKNIGHT
-	b.Squares[57] = BLACKKNIGHT
-	b.Squares[62] = BLACKKNIGHT
+	b.put(WHITEKNIGHT, 1)
+	b.put(WHITEKNIGHT, 6)
+	b.put(BLACKKNIGHT, 57)
+	b.put(BLACKKNIGHT, 62)
 	// Add &Bishops.
-	b.Squares[2] = WHITEBISHOP
-	b.Squares[5] = WHITEBISHOP
-	b.Squares[58] = BLACKBISHOP
-	b.Squares[61] = BLACKBISHOP
+	b.put(WHITEBISHOP, 2)
+	b.put(WHITEBISHOP, 5)
+	b.put(BLACKBISHOP, 58)
+	b.put(BLACKBISHOP, 61)
 	// Add queens
-	b.Squares[3] = WHITEQUEEN
-	b.Squares[59] = BLACKQUEEN
+	b.put(WHITEQUEEN, 3)
+	b.put(BLACKQUEEN, 59)
 	// Add Kings
-	b.Squares[4] = WHITEKING
-	b.Squares[60] = BLACKKING
-	b.Position = Position{}
-	for s, p := range b.Squares {
-		if p != NULLPIECE {
-			b.Position = SetPiece(b.Position, p, Square(s))
-		}
-	}
-	b.Position = UpdateBitboards(b.Position)
+	b.put(WHITEKING, 4)
+	b.put(BLACKKING, 60)
 	b.WKSCastling = true
 	b.WQSCastling = true
 	b.BKSCastling = true
 	b.BQSCastling = true
 	b.Move = 1
 	b.EPSquare = OFFBOARD_SQUARE
-	b.History = make([]Position, 50)
+	b.Hash = ZobristHash(b)
+	b.PawnHash = ZobristPawnHash(b)
+	b.Keys = []uint64{b.Hash}
 	return b
 }
 
@@ -120,6 +145,10 @@ func ApplyMove(b *Board, m EfficientMove) BoardState {
 		WQSCastling: b.WQSCastling,
 		BQSCastling: b.BQSCastling,
 		EPSquare: b.EPSquare,
+		Move: b.Move,
+		HalfMoveClock: b.HalfMoveClock,
+		Hash: b.Hash,
+		PawnHash: b.PawnHash,
 	}
 	if p == NULLPIECE {
 		b.Print()
@@ -136,25 +165,36 @@ func ApplyMove(b *Board, m EfficientMove) BoardState {
 		fmt.Println(m)
 		fmt.Println("capturing offboard sq..")
 	}
+	// Castling rights and en passant are hashed back in once they're updated.
+	hash := b.Hash ^ castlingKey(b) ^ epKey(b)
+	pawnHash := b.PawnHash
 	// If there's a capture: remove the captured piece.
 	if c != NULLPIECE {
 		// In en passant, the piece is not on the square we move to.
 		if m.EnPassant() {
-			b.Position = UnSetPiece(b.Position, c, b.EPSquare)
-			b.Squares[b.EPSquare] = NULLPIECE
+			b.remove(c, b.EPSquare)
+			hash ^= ZOBRISTPIECES[c][b.EPSquare]
+			pawnHash ^= pawnKey(c, b.EPSquare)
 		} else {
-			b.Position = UnSetPiece(b.Position, c, s)
-			b.Squares[s] = NULLPIECE
+			b.remove(c, s)
+			hash ^= ZOBRISTPIECES[c][s]
+			pawnHash ^= pawnKey(c, s)
 		}
 	}
 	// Then, move the piece to its new square.
 	// Check for promotion of a pawn.
+	// Take the piece off its old square first, so the new one is free.
+	b.remove(p, o)
+	hash ^= ZOBRISTPIECES[p][o]
+	pawnHash ^= pawnKey(p, o)
 	if m.Promotion() != NULLPIECE {
-		b.Squares[s] = m.Promotion()
-		b.Position = SetPiece(b.Position, m.Promotion(), s)
+		b.put(m.Promotion(), s)
+		hash ^= ZOBRISTPIECES[m.Promotion()][s]
+		pawnHash ^= pawnKey(m.Promotion(), s)
 	} else {
-		b.Squares[s] = p
-		b.Position = SetPiece(b.Position, p, s)
+		b.put(p, s)
+		hash ^= ZOBRISTPIECES[p][s]
+		pawnHash ^= pawnKey(p, s)
 	}
 	// Check for castling and modify rook state if so.  // New rook squares are relative to king.
 	if m.QSCastle() || m.KSCastle() {
@@ -168,14 +208,11 @@ func ApplyMove(b *Board, m EfficientMove) BoardState {
 			newRookSquare = GetSquare(o.Row(), o.Col()+1)
 			oldRookSquare = GetSquare(o.Row(), 8)
 		}
-		b.Squares[newRookSquare] = b.Squares[oldRookSquare]
-		b.Position = SetPiece(b.Position, b.Squares[oldRookSquare], newRookSquare)
-		b.Position = UnSetPiece(b.Position, b.Squares[oldRookSquare], oldRookSquare)
-		b.Squares[oldRookSquare] = NULLPIECE
-	}
-	// Then, remove the piece from its old square.
-	b.Position = UnSetPiece(b.Position, p, o)
-	b.Squares[o] = NULLPIECE
+		rook := b.Squares[oldRookSquare]
+		b.remove(rook, oldRookSquare)
+		b.put(rook, newRookSquare)
+		hash ^= ZOBRISTPIECES[rook][newRookSquare] ^ ZOBRISTPIECES[rook][oldRookSquare]
+	}
 	// Modify castling state from rook and king moves.
 	// We know any piece moving from e8, e1, a8, h8, a1, or h1 must
 	// change castling rights.
@@ -215,16 +252,27 @@ func ApplyMove(b *Board, m EfficientMove) BoardState {
 		b.EPSquare = OFFBOARD_SQUARE
 	}
 
-	// Advance the move counter.
+	// Advance the move counters. Captures and pawn moves can't be undone,
+	// so they reset the fifty-move clock.
 	if b.Active == BLACK {
 		b.Move++
 	}
+	if c != NULLPIECE || p.Type() == PAWN {
+		b.HalfMoveClock = 0
+	} else {
+		b.HalfMoveClock++
+	}
 	b.LastMove = m
-	// Update bitboard representations.
-	b.Position = UpdateBitboards(b.Position)
+	b.Hash = hash ^ castlingKey(b) ^ epKey(b)
+	b.PawnHash = pawnHash
+	if debug {
+		b.verifyHash("ApplyMove " + m.String())
+		b.verifyConsistency("ApplyMove " + m.String())
+	}
 
-	// Update this board's move history.
-	b.History = append(b.History, b.Position)
+	// Update this board's move history. The active player hasn't been
+	// switched yet, but the key is for the position with the opponent to move.
+	b.Keys = append(b.Keys, b.Hash^ZOBRISTTURN)
 	return bs
 }
 
@@ -236,26 +284,20 @@ func UndoMove(b *Board, m EfficientMove, bs BoardState) {
 	s := m.Square()
 	c := m.Capture()
 
-	// Remove ourselves from our square.
-	b.Squares[s] = NULLPIECE
-
-	// Undo promotions and change our candidate piece to a pawn.
+	// Remove ourselves from our square, undoing any promotion, and return
+	// to the original one.
 	if m.Promotion() != NULLPIECE {
-		b.Position = UnSetPiece(b.Position, m.Promotion(), s)
+		b.remove(m.Promotion(), s)
 	} else {
-		b.Position = UnSetPiece(b.Position, p, s)
+		b.remove(p, s)
 	}
-	// Return our piece to its original place.
-	b.Position = SetPiece(b.Position, p, o)
-	b.Squares[o] = p
+	b.put(p, o)
 	// Return a captured piece.
 	if c != NULLPIECE {
-		if m.EnPassant(){
-			b.Squares[bs.EPSquare] = c
-		        b.Position = SetPiece(b.Position, c, bs.EPSquare)
+		if m.EnPassant() {
+			b.put(c, bs.EPSquare)
 		} else {
-			b.Squares[s] = c
-		        b.Position = SetPiece(b.Position, c, s)
+			b.put(c, s)
 		}
 	}
 
@@ -272,10 +314,8 @@ func UndoMove(b *Board, m EfficientMove, bs BoardState) {
 			oldRookSquare = GetSquare(o.Row(), 8)
 		}
 		rook := b.Squares[newRookSquare]
-		b.Squares[newRookSquare] = NULLPIECE
-		b.Position = UnSetPiece(b.Position, rook, newRookSquare)
-		b.Squares[oldRookSquare] = rook
-		b.Position = SetPiece(b.Position, rook, oldRookSquare)
+		b.remove(rook, newRookSquare)
+		b.put(rook, oldRookSquare)
 	}
 
 	// Reapply original castling rights.
@@ -286,16 +326,82 @@ func UndoMove(b *Board, m EfficientMove, bs BoardState) {
 
 	// Reapply original en passant column.
 	b.EPSquare = bs.EPSquare
-	// Reverse the move counter.
-	if b.Active == BLACK {
-		b.Move--
-	}
+	// Restore the move counters. They are saved rather than recomputed,
+	// since callers may undo before switching the active player back.
+	b.Move = bs.Move
+	b.HalfMoveClock = bs.HalfMoveClock
 	b.LastMove = bs.LastMove
+	// The saved hash has the mover to play, but callers may already have
+	// switched the active player back.
+	b.Hash = bs.Hash
+	if b.Active != p.Color() {
+		b.Hash ^= ZOBRISTTURN
+	}
+	b.PawnHash = bs.PawnHash
+
+	b.Keys = b.Keys[:len(b.Keys)-1]
+	if debug {
+		b.verifyHash("UndoMove " + m.String())
+		b.verifyConsistency("UndoMove " + m.String())
+	}
+}
+
+// put places p on the empty square s.
+func (b *Board) put(p Piece, s Square) {
+	b.Position.Put(p, s)
+	b.Squares[s] = p
+}
+
+// remove takes p off s.
+func (b *Board) remove(p Piece, s Square) {
+	b.Position.Remove(p, s)
+	b.Squares[s] = NULLPIECE
+}
+
+// Clone returns a deep copy of the board that can be modified (or handed
+// to another goroutine) without affecting the original.
+func (b *Board) Clone() *Board {
+	c := *b
+	c.AllMoves = append([]EfficientMove(nil), b.AllMoves...)
+	c.Keys = append([]uint64(nil), b.Keys...)
+	c.states = append([]BoardState(nil), b.states...)
+	return &c
+}
 
+// Push makes move m and switches the active player, remembering what Pop
+// needs to take it back. It's for playing through games; the search makes
+// and unmakes moves with ApplyMove and UndoMove, which don't allocate.
+func (b *Board) Push(m EfficientMove) {
+	bs := ApplyMove(b, m)
+	b.SwitchActivePlayer()
+	b.AllMoves = append(b.AllMoves, m)
+	b.states = append(b.states, bs)
+}
 
-	b.Position = UpdateBitboards(b.Position)
-	b.History = b.History[:len(b.History) - 1]
+// Pop takes back the last move made by Push, leaving the player who made
+// it to move, and returns it. It returns false if there's no such move.
+func (b *Board) Pop() (EfficientMove, bool) {
+	n := len(b.states)
+	if n == 0 {
+		return EfficientMove(0), false
+	}
+	m := b.AllMoves[len(b.AllMoves)-1]
+	b.SwitchActivePlayer()
+	UndoMove(b, m, b.states[n-1])
+	b.AllMoves = b.AllMoves[:len(b.AllMoves)-1]
+	b.states = b.states[:n-1]
+	return m, true
+}
 
+// CopyMake sets dst to the position after m, with the opponent to move,
+// and leaves b as it was. It's the copy-make alternative to ApplyMove and
+// UndoMove: there's nothing to undo, since b never changed. dst shares b's
+// Keys and AllMoves, so it's only for use by the same goroutine, and only
+// until b makes another move; Clone b to hand it to another goroutine.
+func (b *Board) CopyMake(dst *Board, m EfficientMove) {
+	*dst = *b
+	ApplyMove(dst, m)
+	dst.SwitchActivePlayer()
 }
 
 func (b *Board) SwitchActivePlayer() {
@@ -305,72 +411,42 @@ func (b *Board) SwitchActivePlayer() {
 	case BLACK:
 		b.Active = WHITE
 	}
+	b.Hash ^= ZOBRISTTURN
+	if debug {
+		b.verifyHash("SwitchActivePlayer")
+	}
+}
+
+// SetEPSquare changes the square of the pawn that can be captured en
+// passant, keeping the hash up to date.
+func (b *Board) SetEPSquare(s Square) {
+	b.Hash ^= epKey(b)
+	b.EPSquare = s
+	b.Hash ^= epKey(b)
 }
 
 // AllLegalMoves enumerates all of the legal moves currently available to the
 // active player.
 func (b *Board) AllLegalMoves() []EfficientMove {
-	var moves []EfficientMove
-	for s, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() != b.Active {
-			continue
-		}
-		m := LegalMoves(b, p, Square(s))
-		for i := 0; i < len(m); i++ {
-			bs := ApplyMove(b, m[i])
-			if !IsCheck(b, b.Active) {
-				moves = append(moves, m[i])
-			}
-			UndoMove(b, m[i], bs)
-		}
-	}
-	return moves
+	l := newLegality(b)
+	return b.generateLegalMoves(&l, nil, ALLSQUARES, ALLSQUARES, ALLSQUARES)
 }
 
 // AllLegalCaptures enumerates all of the legal captures currently available to the
 // active player.
 func (b *Board) AllLegalCaptures() []EfficientMove {
-	var moves []EfficientMove
-	for s, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() != b.Active {
-			continue
-		}
-		m := LegalCaptures(b, p, Square(s))
-		for _, move := range m {
-			bs := ApplyMove(b, move)
-			if !IsCheck(b, b.Active) {
-				moves = append(moves, move)
-			}
-			UndoMove(b, move, bs)
-		}
-	}
-	return moves
+	l := newLegality(b)
+	return b.generateLegalMoves(&l, nil, ALLSQUARES, l.opp, 0)
 }
 
 // AllLegalChecks enumerates all of the legal checks currently available to the
 // active player.
 func (b *Board) AllLegalChecks() []EfficientMove {
 	var moves []EfficientMove
-	for s, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() != b.Active {
-			continue
-		}
-		m := LegalMoves(b, p, Square(s))
-		for _, move := range m {
-			bs := ApplyMove(b, move)
-			if !IsCheck(b, b.Active) && IsCheck(b, -1 * b.Active) {
-				moves = append(moves, move)
-			}
-			UndoMove(b, move, bs)
+	ci := newCheckInfo(b)
+	for _, move := range b.AllLegalMoves() {
+		if ci.givesCheck(b, move) {
+			moves = append(moves, move)
 		}
 	}
 	return moves
@@ -380,53 +456,26 @@ func (b *Board) AllLegalChecks() []EfficientMove {
 // active player.
 func (b *Board) AllLegalChecksAndCaptures() []EfficientMove {
 	var moves []EfficientMove
-	for s, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() != b.Active {
-			continue
-		}
-		m := LegalMoves(b, p, Square(s))
-		for _, move := range m {
-			bs := ApplyMove(b, move)
-			if !IsCheck(b, b.Active) && (IsCheck(b, -1 * b.Active) || move.Capture() != NULLPIECE){
-				moves = append(moves, move)
-			}
-			UndoMove(b, move, bs)
+	ci := newCheckInfo(b)
+	for _, move := range b.AllLegalMoves() {
+		if move.Capture() != NULLPIECE || ci.givesCheck(b, move) {
+			moves = append(moves, move)
 		}
 	}
 	return moves
 }
 
+// AllQuiescenceMoves returns the legal moves worth searching in quiescence
+// search, and all of the legal moves. Quiescence moves are every move when
+// in check, and otherwise captures, promotions and checks.
 func (b *Board) AllQuiescenceMoves() ([]EfficientMove, []EfficientMove) {
 	var qmoves []EfficientMove
-	var allmoves []EfficientMove
-	var startincheck = IsCheck(b, b.Active)
-	for s, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() != b.Active {
-			continue
-		}
-		m := LegalMoves(b, p, Square(s))
-		for _, move := range m {
-			// Otherwise, see if it's a check or capture.
-			bs := ApplyMove(b, move)
-			if !IsCheck(b, b.Active) {
-				// We are not in check, so this move is legal.
-				allmoves = append(allmoves, move)
-				// Check Quiescence Conditions
-				// * Start in check
-				// * Delivers check
-				// * Captures
-				// * Promotions
-				if startincheck ||  IsCheck(b, -1 * b.Active) || move.Capture() != NULLPIECE || move.Promotion() != NULLPIECE {
-					qmoves = append(qmoves, move)
-				}
-			}
-			UndoMove(b, move, bs)
+	allmoves := b.AllLegalMoves()
+	startincheck := IsCheck(b, b.Active)
+	ci := newCheckInfo(b)
+	for _, move := range allmoves {
+		if startincheck || move.Capture() != NULLPIECE || move.Promotion() != NULLPIECE || ci.givesCheck(b, move) {
+			qmoves = append(qmoves, move)
 		}
 	}
 	return qmoves, allmoves
@@ -448,49 +497,116 @@ func (b *Board) CalculateGameOver(lm []EfficientMove) (bool, Color) {
 
 	}
 
-	posCount := 0
-	for _, h := range b.History {
-		if h == b.Position {
-			posCount += 1
-		}
-		if posCount >= 3 {
-			// Draw by repetition!
-			return true, 0
-		}
+	if b.IsThreefoldRepetition() || b.IsFiftyMoveDraw() || b.IsInsufficientMaterial() {
+		return true, 0
 	}
 
 	return false, 0
 }
 
+// IsThreefoldRepetition returns true if the current position has occurred
+// at least three times.
+func (b *Board) IsThreefoldRepetition() bool {
+	return b.repetitions(0) >= 2
+}
+
+// IsRepetition returns true if the current position should be scored as a
+// draw by a search that is ply moves deep. Any repetition of a position
+// reached within the search counts, since if repeating was good for either
+// side once, it will be good again. Positions from before the search need
+// to occur three times, as in the game.
+func (b *Board) IsRepetition(ply int) bool {
+	if ply <= 0 {
+		return b.IsThreefoldRepetition()
+	}
+	reps := b.repetitions(len(b.Keys) - 1 - ply)
+	return reps > 0 || b.IsThreefoldRepetition()
+}
+
+// repetitions returns how many earlier positions with index >= since in the
+// key stack are the same as the current one. Positions from before the
+// last capture or pawn move can't repeat, so we don't look at them.
+func (b *Board) repetitions(since int) int {
+	key := b.Hash
+	if irreversible := len(b.Keys) - 1 - b.HalfMoveClock; irreversible > since {
+		since = irreversible
+	}
+	if since < 0 {
+		since = 0
+	}
+	n := 0
+	for i := len(b.Keys) - 2; i >= since; i-- {
+		if b.Keys[i] == key {
+			n++
+		}
+	}
+	return n
+}
+
+// IsFiftyMoveDraw returns true if fifty moves have passed for each side
+// without a capture or pawn move. Checkmate takes precedence, so this
+// should be checked after making sure the active player has a legal move.
+func (b *Board) IsFiftyMoveDraw() bool {
+	return b.HalfMoveClock >= FIFTY_MOVE_RULE_PLIES
+}
+
+// Bitboards of the light and dark squares.
+var lightSquares = uint64(0x55AA55AA55AA55AA)
+var darkSquares = uint64(0xAA55AA55AA55AA55)
+
+// IsInsufficientMaterial returns true if neither side has the material
+// to ever checkmate: bare kings, a single minor piece, or only bishops
+// that all travel on the same color of square.
+func (b *Board) IsInsufficientMaterial() bool {
+	pos := b.Position
+	if pos.WhitePawns|pos.BlackPawns|pos.WhiteRooks|pos.BlackRooks|pos.WhiteQueens|pos.BlackQueens != 0 {
+		return false
+	}
+	knights := pos.WhiteKnights | pos.BlackKnights
+	bishops := pos.WhiteBishops | pos.BlackBishops
+	if bits.OnesCount64(knights|bishops) <= 1 {
+		return true
+	}
+	if knights != 0 {
+		return false
+	}
+	return bishops&lightSquares == 0 || bishops&darkSquares == 0
+}
+
 // Returns true if the board state results in the Color c's king being in check.
 func IsCheck(b *Board, c Color) bool {
-	atk := GetAttackBitboard(b, -1*c)
+	var king uint64
 	switch c {
 	case WHITE:
-		return atk&b.Position.WhiteKing > 0
+		king = b.Position.WhiteKing
 	case BLACK:
-		return atk&b.Position.BlackKing > 0
+		king = b.Position.BlackKing
 	}
-
-	return false
+	if king == 0 {
+		return false
+	}
+	return AttackersTo(b, Square(bits.TrailingZeros64(king)), b.Position.Occupied, -1*c) != 0
 }
 
 // Returns a bitboard of all squares currently being attacked by c.
-// Attacked means a piece could be captured.
+// Attacked means a piece could be captured. To ask about only a few
+// squares, AttackersTo is much cheaper.
 func GetAttackBitboard(b *Board, c Color) uint64 {
 	var res uint64
-	var p Piece
-	res = 0
-	for i := 0; i < 64; i++ {
-		p = b.Squares[i]
-		if p != NULLPIECE && p.Color() == c {
-			res = res | AttackBitboard(b, p, Square(i))
-		}
+	pieces := b.Position.WhitePieces
+	if c == BLACK {
+		pieces = b.Position.BlackPieces
+	}
+	for ; pieces != 0; pieces &= pieces - 1 {
+		s := Square(bits.TrailingZeros64(pieces))
+		res |= AttackBitboard(b, b.Squares[s], s)
 	}
 	return res
 }
 
-// Returns the hash value for this board.
+// Returns the hash value for this board, computed from scratch. Boards keep
+// theirs up to date in b.Hash, so this is only needed to set up a new board
+// or to check the running hash.
 func ZobristHash(b *Board) uint64 {
 	var hash uint64
 	hash = 0
@@ -502,6 +618,30 @@ func ZobristHash(b *Board) uint64 {
 	if b.Active == WHITE {
 		hash = hash ^ ZOBRISTTURN
 	}
+	return hash ^ castlingKey(b) ^ epKey(b)
+}
+
+// ZobristPawnHash returns the hash of the pawns and kings on the board,
+// computed from scratch. Like ZobristHash, boards keep theirs in b.PawnHash.
+func ZobristPawnHash(b *Board) uint64 {
+	var hash uint64
+	for s, p := range b.Squares {
+		hash ^= pawnKey(p, Square(s))
+	}
+	return hash
+}
+
+// pawnKey returns the part of the pawn hash for piece p on square s.
+func pawnKey(p Piece, s Square) uint64 {
+	if t := p.Type(); t == PAWN || t == KING {
+		return ZOBRISTPIECES[p][s]
+	}
+	return 0
+}
+
+// castlingKey returns the part of the hash for the board's castling rights.
+func castlingKey(b *Board) uint64 {
+	var hash uint64
 	if b.WQSCastling {
 		hash = hash ^ ZOBRISTWQS
 	}
@@ -516,3 +656,65 @@ func ZobristHash(b *Board) uint64 {
 	}
 	return hash
 }
+
+// epKey returns the part of the hash for the file of a pawn that can be
+// captured en passant.
+func epKey(b *Board) uint64 {
+	if b.EPSquare == OFFBOARD_SQUARE {
+		return 0
+	}
+	return ZOBRISTEP[b.EPSquare.Col()-1]
+}
+
+// verifyHash panics if the board's running hashes don't match a full
+// recompute. It's only called in debug builds.
+func (b *Board) verifyHash(after string) {
+	if want := ZobristHash(b); b.Hash != want {
+		b.Print()
+		panic(fmt.Sprintf("zobrist hash after %v is %x, want %x", after, b.Hash, want))
+	}
+	if want := ZobristPawnHash(b); b.PawnHash != want {
+		b.Print()
+		panic(fmt.Sprintf("pawn hash after %v is %x, want %x", after, b.PawnHash, want))
+	}
+}
+
+// CheckConsistency returns an error if the bitboards and the mailbox
+// disagree about where the pieces are, or if the color and occupancy
+// bitboards don't add up to the piece bitboards.
+func (b *Board) CheckConsistency() error {
+	pos := &b.Position
+	var seen uint64
+	for p := WHITEPAWN; p <= BLACKKING; p++ {
+		bb := pos.PieceBoard(p)
+		if bb == nil {
+			continue
+		}
+		if *bb&seen != 0 {
+			return fmt.Errorf("%v shares squares %v with other pieces", p, SquaresFromBitBoard(*bb&seen))
+		}
+		seen |= *bb
+	}
+	if want := UpdateBitboards(*pos); want != *pos {
+		return fmt.Errorf("color or occupancy bitboards don't match the pieces: got %+v, want %+v", *pos, want)
+	}
+	for s, p := range b.Squares {
+		bb := uint64(1) << uint(s)
+		switch {
+		case p == NULLPIECE && pos.Occupied&bb != 0:
+			return fmt.Errorf("%v is empty in the mailbox, but occupied in the bitboards", Square(s))
+		case p != NULLPIECE && *pos.PieceBoard(p)&bb == 0:
+			return fmt.Errorf("%v has %v in the mailbox, but not in the bitboards", Square(s), p)
+		}
+	}
+	return nil
+}
+
+// verifyConsistency panics if CheckConsistency finds a problem. It's only
+// called in debug builds.
+func (b *Board) verifyConsistency(after string) {
+	if err := b.CheckConsistency(); err != nil {
+		b.Print()
+		panic(fmt.Sprintf("board after %v is inconsistent: %v", after, err))
+	}
+}
@@ -0,0 +1,372 @@
+package game
+
+import "fmt"
+import "testing"
+
+func TestHalfMoveClock(t *testing.T) {
+	InitInternalData()
+	b, err := BoardFromFen("4k3/8/8/8/8/8/4P3/R3K3 w - - 12 40")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	if b.HalfMoveClock != 12 || b.Move != 40 {
+		t.Fatalf("fen counters: got halfmove clock %v, move %v, want 12, 40", b.HalfMoveClock, b.Move)
+	}
+	testCases := []struct {
+		name string
+		move EfficientMove
+		want int
+	}{
+		{
+			name: "quiet rook move",
+			move: NewEfficientMove(WHITEROOK, A5, A1),
+			want: 13,
+		}, {
+			name: "pawn move",
+			move: NewEfficientMove(WHITEPAWN, E3, E2),
+			want: 0,
+		},
+	}
+	for _, tc := range testCases {
+		bs := ApplyMove(b, tc.move)
+		if b.HalfMoveClock != tc.want {
+			t.Errorf("%v: got halfmove clock %v, want %v", tc.name, b.HalfMoveClock, tc.want)
+		}
+		UndoMove(b, tc.move, bs)
+		if b.HalfMoveClock != 12 || b.Move != 40 {
+			t.Errorf("%v: undo left halfmove clock %v, move %v, want 12, 40", tc.name, b.HalfMoveClock, b.Move)
+		}
+	}
+}
+
+func TestDraws(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{
+			name: "fifty move rule",
+			fen:  "4k3/8/8/8/8/8/8/R3K3 b - - 100 80",
+			want: true,
+		}, {
+			name: "one move short of fifty move rule",
+			fen:  "4k3/8/8/8/8/8/8/R3K3 b - - 99 80",
+			want: false,
+		}, {
+			name: "checkmate on the fiftieth move",
+			fen:  "R3k3/8/4K3/8/8/8/8/8 b - - 100 80",
+			want: false,
+		}, {
+			name: "bare kings",
+			fen:  "4k3/8/8/8/8/8/8/4K3 w - - 0 1",
+			want: true,
+		}, {
+			name: "lone knight",
+			fen:  "4k3/8/8/8/8/8/8/3NK3 w - - 0 1",
+			want: true,
+		}, {
+			name: "bishops on the same color",
+			fen:  "4kb2/8/8/8/8/8/8/2B1K3 w - - 0 1",
+			want: true,
+		}, {
+			name: "bishops on opposite colors",
+			fen:  "2b1k3/8/8/8/8/8/8/2B1K3 w - - 0 1",
+			want: false,
+		}, {
+			name: "two knights",
+			fen:  "4k3/8/8/8/8/8/8/2NNK3 w - - 0 1",
+			want: false,
+		}, {
+			name: "lone pawn",
+			fen:  "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1",
+			want: false,
+		},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		over, winner := b.CalculateGameOver(b.AllLegalMoves())
+		if got := over && winner == 0; got != tc.want {
+			t.Errorf("%v: got draw %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRepetition(t *testing.T) {
+	InitInternalData()
+	b := DefaultBoard()
+	shuffle := []EfficientMove{
+		NewEfficientMove(WHITEKNIGHT, F3, G1),
+		NewEfficientMove(BLACKKNIGHT, F6, G8),
+		NewEfficientMove(WHITEKNIGHT, G1, F3),
+		NewEfficientMove(BLACKKNIGHT, G8, F6),
+	}
+	for _, m := range shuffle {
+		ApplyMove(b, m)
+		b.SwitchActivePlayer()
+	}
+	if b.IsThreefoldRepetition() {
+		t.Errorf("second occurrence of the starting position is a threefold repetition")
+	}
+	if !b.IsRepetition(4) {
+		t.Errorf("repeating a position 4 plies into a search is not a draw")
+	}
+	if b.IsRepetition(3) {
+		t.Errorf("repeating a position from before a 3 ply search is a draw")
+	}
+	for _, m := range shuffle {
+		ApplyMove(b, m)
+		b.SwitchActivePlayer()
+	}
+	if !b.IsThreefoldRepetition() {
+		t.Errorf("third occurrence of the starting position is not a threefold repetition")
+	}
+	// A pawn move means none of the earlier positions can come back.
+	ApplyMove(b, NewEfficientMove(WHITEPAWN, E4, E2).AddTwoPawnAdvance())
+	b.SwitchActivePlayer()
+	if b.IsRepetition(100) {
+		t.Errorf("position after a pawn move is a repetition")
+	}
+}
+
+func TestIncrementalHash(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name  string
+		fen   string
+		depth int
+	}{
+		{
+			name:  "kiwipete",
+			fen:   "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+			depth: 3,
+		}, {
+			name:  "promotions",
+			fen:   "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+			depth: 3,
+		}, {
+			name:  "en passant",
+			fen:   "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+			depth: 4,
+		},
+	}
+	var walk func(b *Board, depth int) error
+	walk = func(b *Board, depth int) error {
+		if depth == 0 {
+			return nil
+		}
+		for _, m := range b.AllLegalMoves() {
+			bs := ApplyMove(b, m)
+			b.SwitchActivePlayer()
+			if want := ZobristHash(b); b.Hash != want {
+				return fmt.Errorf("after %v: got hash %x, want %x", m, b.Hash, want)
+			}
+			if want := ZobristPawnHash(b); b.PawnHash != want {
+				return fmt.Errorf("after %v: got pawn hash %x, want %x", m, b.PawnHash, want)
+			}
+			if err := walk(b, depth-1); err != nil {
+				return fmt.Errorf("%v %v", m, err)
+			}
+			UndoMove(b, m, bs)
+			b.SwitchActivePlayer()
+			if want := ZobristHash(b); b.Hash != want {
+				return fmt.Errorf("undoing %v: got hash %x, want %x", m, b.Hash, want)
+			}
+			if want := ZobristPawnHash(b); b.PawnHash != want {
+				return fmt.Errorf("undoing %v: got pawn hash %x, want %x", m, b.PawnHash, want)
+			}
+		}
+		return nil
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		before := b.Hash
+		if err := walk(b, tc.depth); err != nil {
+			t.Errorf("%v: %v", tc.name, err)
+		}
+		if b.Hash != before {
+			t.Errorf("%v: hash changed from %x to %x after undoing every move", tc.name, before, b.Hash)
+		}
+	}
+
+	// A pawn that can be captured en passant makes for a different position.
+	b, err := BoardFromFen("4k3/8/8/8/8/8/4P3/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	noEP := b.Hash
+	b.SetEPSquare(E4)
+	if b.Hash == noEP || b.Hash != ZobristHash(b) {
+		t.Errorf("setting the en passant square: got hash %x, want %x (and not %x)", b.Hash, ZobristHash(b), noEP)
+	}
+}
+
+// Test that the en passant square in a fen matches playing the moves.
+func TestFenEnPassant(t *testing.T) {
+	InitInternalData()
+	b := DefaultBoard()
+	for _, s := range []string{"Pe2-e4", "Pa7-a6", "Pe4-e5", "Pd7-d5"} {
+		var move EfficientMove
+		for _, m := range b.AllLegalMoves() {
+			if m.String() == s {
+				move = m
+			}
+		}
+		if move == EfficientMove(0) {
+			t.Fatalf("%v is not a legal move", s)
+		}
+		ApplyMove(b, move)
+		b.SwitchActivePlayer()
+	}
+	fen, err := BoardFromFen("rnbqkbnr/1pp1pppp/p7/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 3")
+	if err != nil {
+		t.Fatalf("error reading fen string: %v", err)
+	}
+	if fen.EPSquare != D5 {
+		t.Errorf("got en passant square %v, want %v", fen.EPSquare, D5)
+	}
+	if fen.Hash != b.Hash {
+		t.Errorf("got hash %x, want %x from playing the moves", fen.Hash, b.Hash)
+	}
+	if _, err := BoardFromFen("rnbqkbnr/1pp1pppp/p7/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d3 0 3"); err == nil {
+		t.Errorf("got no error for an en passant square behind the wrong side's pawn")
+	}
+}
+
+// Test that CheckConsistency catches the mailbox and bitboards drifting
+// apart.
+func TestCheckConsistency(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name    string
+		corrupt func(b *Board)
+		ok      bool
+	}{
+		{
+			name:    "starting board",
+			corrupt: func(b *Board) {},
+			ok:      true,
+		}, {
+			name:    "piece only in the mailbox",
+			corrupt: func(b *Board) { b.Squares[E4] = WHITEKNIGHT },
+		}, {
+			name:    "piece only in the bitboards",
+			corrupt: func(b *Board) { b.Position.Put(WHITEKNIGHT, E4) },
+		}, {
+			name:    "stale occupancy",
+			corrupt: func(b *Board) { b.Position.Occupied |= 1 << E4 },
+		}, {
+			name: "two pieces on a square",
+			corrupt: func(b *Board) {
+				b.Position.BlackQueens |= 1 << E1
+			},
+		},
+	}
+	for _, tc := range testCases {
+		b := DefaultBoard()
+		tc.corrupt(b)
+		if err := b.CheckConsistency(); (err == nil) != tc.ok {
+			t.Errorf("%v: got error %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
+
+// Test that CopyMake gives the same position as ApplyMove, without
+// changing the board it copies.
+func TestCopyMake(t *testing.T) {
+	InitInternalData()
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/8/8/R2pP2k/8/8/8/K7 w - d6 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	for _, fen := range fens {
+		b, err := BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("error reading fen string %v: %v", fen, err)
+		}
+		before := b.Clone()
+		var dst Board
+		for _, m := range b.AllLegalMoves() {
+			b.CopyMake(&dst, m)
+			want := b.Clone()
+			ApplyMove(want, m)
+			want.SwitchActivePlayer()
+			if dst.Position != want.Position || dst.Squares != want.Squares || dst.Hash != want.Hash || dst.Active != want.Active {
+				t.Errorf("%v: CopyMake(%v) gives a different position to ApplyMove", fen, m)
+			}
+			if len(dst.Keys) != len(want.Keys) || dst.Keys[len(dst.Keys)-1] != want.Hash {
+				t.Errorf("%v: CopyMake(%v) gives keys %v, want %v", fen, m, dst.Keys, want.Keys)
+			}
+			if b.Position != before.Position || b.Hash != before.Hash || len(b.Keys) != len(before.Keys) {
+				t.Errorf("%v: CopyMake(%v) changed the board it copied", fen, m)
+			}
+		}
+	}
+}
+
+// Test that moves made on a clone don't show up on the original.
+func TestClone(t *testing.T) {
+	InitInternalData()
+	b := DefaultBoard()
+	c := b.Clone()
+	m := NewEfficientMove(WHITEPAWN, E4, E2).AddTwoPawnAdvance()
+	ApplyMove(c, m)
+	c.SwitchActivePlayer()
+	c.AllMoves = append(c.AllMoves, m)
+	if b.Position != DefaultBoard().Position || b.Active != WHITE || len(b.Keys) != 1 || len(b.AllMoves) != 0 {
+		t.Errorf("making a move on a clone changed the original")
+	}
+	if len(c.Keys) != 2 || c.Keys[0] != b.Keys[0] {
+		t.Errorf("clone doesn't follow on from the original's keys: got %v, want %v first", c.Keys, b.Keys)
+	}
+}
+
+// Test that popping every pushed move gets back to where we started, and
+// that pushing switches the player to move.
+func TestPushPop(t *testing.T) {
+	InitInternalData()
+	b, err := BoardFromFen("r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen string: %v", err)
+	}
+	want := b.Clone()
+	// Follow the first legal move for a while, which includes captures,
+	// castling and promotions from this position.
+	var pushed []EfficientMove
+	for i := 0; i < 12; i++ {
+		moves := b.AllLegalMoves()
+		if len(moves) == 0 {
+			break
+		}
+		active := b.Active
+		b.Push(moves[0])
+		pushed = append(pushed, moves[0])
+		if b.Active != -1*active {
+			t.Errorf("after pushing %v: got %v to move, want %v", moves[0], b.Active, -1*active)
+		}
+	}
+	if len(b.AllMoves) != len(pushed) {
+		t.Errorf("got %v moves pushed, want %v", len(b.AllMoves), len(pushed))
+	}
+	for i := len(pushed) - 1; i >= 0; i-- {
+		if m, ok := b.Pop(); !ok || m != pushed[i] {
+			t.Errorf("got pop %v (%v), want %v", m, ok, pushed[i])
+		}
+	}
+	if m, ok := b.Pop(); ok {
+		t.Errorf("popped %v with nothing pushed", m)
+	}
+	if b.Position != want.Position || b.Squares != want.Squares || b.Active != want.Active || b.Hash != want.Hash ||
+		b.PawnHash != want.PawnHash || b.EPSquare != want.EPSquare || b.BKSCastling != want.BKSCastling ||
+		b.BQSCastling != want.BQSCastling || b.HalfMoveClock != want.HalfMoveClock || len(b.Keys) != len(want.Keys) {
+		t.Errorf("popping every move didn't restore the board")
+	}
+}
@@ -1,6 +1,8 @@
 // Castle.go provides utilities for managing castling.
 package game
 
+import "math/bits"
+
 // bitboards representing squares relevant to castling decisions.
 var wksMustBeUnoccupied = uint64(0x0000000000000060) // bit for bishop and knight
 var wqsMustBeUnoccupied = uint64(0x000000000000000E) // bit for bishop, knight, queen
@@ -79,10 +81,12 @@ func CanCastleGeneric(b *Board, c Color, castleOccupancy uint64, kingSlide uint6
 	if b.Position.Occupied&castleOccupancy > 0 {
 		return false
 	}
-	atk := GetAttackBitboard(b, -1*c)
 	// Don't castle if any king square is under attack.
-	if atk&kingSlide > 0 {
-		return false
+	for ; kingSlide != 0; kingSlide &= kingSlide - 1 {
+		s := Square(bits.TrailingZeros64(kingSlide))
+		if AttackersTo(b, s, b.Position.Occupied, -1*c) != 0 {
+			return false
+		}
 	}
 
 	return true
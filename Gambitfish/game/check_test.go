@@ -0,0 +1,80 @@
+package game
+
+import "testing"
+
+// Test that GivesCheck agrees with making each move and looking for check,
+// in every position a couple of plies deep.
+func TestGivesCheckMatchesMakeTest(t *testing.T) {
+	InitInternalData()
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		// Castling checks with the rook.
+		"5k2/8/8/8/8/8/8/R3K2R w KQ - 0 1",
+		// En passant uncovers a rook and a bishop.
+		"8/8/8/R2pP2k/8/8/8/K7 w - d6 0 1",
+		"8/7b/8/8/3pP3/8/8/1K5k b - e3 0 1",
+		// Promotions check along the back rank and down the file the pawn
+		// leaves.
+		"k7/4P3/8/8/8/8/8/4K2R w - - 0 1",
+		"8/3P4/8/8/8/8/8/3k3K w - - 0 1",
+	}
+	var walk func(b *Board, depth int, name string)
+	walk = func(b *Board, depth int, name string) {
+		for _, m := range b.AllLegalMoves() {
+			bs := ApplyMove(b, m)
+			want := IsCheck(b, -1*b.Active)
+			b.SwitchActivePlayer()
+			if depth > 0 {
+				walk(b, depth-1, name+" "+m.String())
+			}
+			UndoMove(b, m, bs)
+			b.SwitchActivePlayer()
+			if got := b.GivesCheck(m); got != want {
+				t.Errorf("%v: %v gives check: got %v, want %v", name, m, got, want)
+			}
+		}
+	}
+	for _, fen := range fens {
+		b, err := BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("error reading fen string %v: %v", fen, err)
+		}
+		walk(b, 2, fen)
+	}
+}
+
+func BenchmarkGivesCheck(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	moves := board.AllLegalMoves()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ci := newCheckInfo(board)
+		for _, m := range moves {
+			ci.givesCheck(board, m)
+		}
+	}
+}
+
+func BenchmarkMakeTestChecks(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	moves := board.AllLegalMoves()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, m := range moves {
+			bs := ApplyMove(board, m)
+			IsCheck(board, -1*board.Active)
+			UndoMove(board, m, bs)
+		}
+	}
+}
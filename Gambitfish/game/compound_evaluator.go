@@ -4,10 +4,37 @@ type CompoundEvaluator struct {
 	Evaluators []Evaluator
 }
 
+// WithPawnTable returns a copy of e whose evaluators that can cache in a
+// pawn table all cache in t.
+func (e CompoundEvaluator) WithPawnTable(t *PawnTable) Evaluator {
+	evaluators := make([]Evaluator, len(e.Evaluators))
+	for i, ev := range e.Evaluators {
+		if pe, ok := ev.(PawnTableEvaluator); ok {
+			ev = pe.WithPawnTable(t)
+		}
+		evaluators[i] = ev
+	}
+	return CompoundEvaluator{Evaluators: evaluators}
+}
+
+// Evaluate sums the evaluations. The middlegame and endgame scores of
+// TaperedEvaluators are summed separately, and blended once at the end.
 func (e CompoundEvaluator) Evaluate(b *Board) float64 {
 	result := 0.0
+	var mg, eg float64
+	tapered := false
 	for _, e := range e.Evaluators {
-		result += e.Evaluate(b)
+		if t, ok := e.(TaperedEvaluator); ok {
+			m, g := t.EvaluateTapered(b)
+			mg += m
+			eg += g
+			tapered = true
+		} else {
+			result += e.Evaluate(b)
+		}
+	}
+	if tapered {
+		result += Taper(mg, eg, GamePhase(b))
 	}
 	return result
 }
@@ -0,0 +1,8 @@
+//go:build debug
+
+package game
+
+// debug turns on expensive consistency checks of the board, such as
+// verifying the running zobrist hash after every move. Build or test with
+// -tags debug to enable it.
+const debug = true
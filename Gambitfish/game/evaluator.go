@@ -5,3 +5,19 @@ package game
 type Evaluator interface {
 	Evaluate(*Board) float64
 }
+
+// TaperedEvaluator is an Evaluator with separate middlegame and endgame
+// scores, which CompoundEvaluator blends by the game phase. Evaluate should
+// return the same blend.
+type TaperedEvaluator interface {
+	Evaluator
+	EvaluateTapered(*Board) (mg, eg float64)
+}
+
+// PawnTableEvaluator is an Evaluator that can cache in a PawnTable. Pawn
+// tables aren't safe for concurrent use, so each search needs its own.
+type PawnTableEvaluator interface {
+	Evaluator
+	// WithPawnTable returns a copy of the evaluator caching in t.
+	WithPawnTable(t *PawnTable) Evaluator
+}
@@ -0,0 +1,154 @@
+package game
+
+import "math"
+import "testing"
+
+func TestGamePhase(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{"starting position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", MAX_PHASE},
+		{"queens traded", "rnb1kbnr/pppppppp/8/8/8/8/PPPPPPPP/RNB1KBNR w KQkq - 0 1", MAX_PHASE - 8},
+		{"rook endgame", "8/5pk1/8/8/8/8/1R3PK1/r7 w - - 0 1", 4},
+		{"pawn endgame", "8/5pk1/8/8/8/8/5PK1/8 w - - 0 1", 0},
+		{"extra queens", "4k3/8/8/8/8/8/8/QQQQKQQQ w - - 0 1", MAX_PHASE},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.fen, err)
+		}
+		if got := GamePhase(b); got != tc.want {
+			t.Errorf("%v: got phase %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTaper(t *testing.T) {
+	testCases := []struct {
+		phase int
+		want  float64
+	}{
+		{MAX_PHASE, 1},
+		{0, -1},
+		{MAX_PHASE / 2, 0},
+	}
+	for _, tc := range testCases {
+		if got := Taper(1, -1, tc.phase); got != tc.want {
+			t.Errorf("Taper(1, -1, %v): got %v, want %v", tc.phase, got, tc.want)
+		}
+	}
+}
+
+// Test that the piece square tables want the king sheltered in the
+// middlegame and in the center in the endgame.
+func TestTaperedKing(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name            string
+		sheltered       string
+		central         string
+		preferSheltered bool
+	}{
+		{
+			name:            "middlegame",
+			sheltered:       "r1bq1rk1/pppp1ppp/2n2n2/2b1p3/2B1P3/2N2N2/PPPP1PPP/R1BQ1RK1 w - - 0 1",
+			central:         "r1bq1rk1/pppp1ppp/2n2n2/2b1p3/2B1P3/2NK1N2/PPPP1PPP/R1BQ1R2 w - - 0 1",
+			preferSheltered: true,
+		}, {
+			name:      "pawn endgame",
+			sheltered: "8/5pk1/8/8/8/8/5P2/6K1 w - - 0 1",
+			central:   "8/5pk1/8/8/3K4/8/5P2/8 w - - 0 1",
+		},
+	}
+	e := PieceSquareEvaluator{}
+	for _, tc := range testCases {
+		sheltered, err := BoardFromFen(tc.sheltered)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.sheltered, err)
+		}
+		central, err := BoardFromFen(tc.central)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.central, err)
+		}
+		if got := e.Evaluate(sheltered) > e.Evaluate(central); got != tc.preferSheltered {
+			t.Errorf("%v: got prefer sheltered king %v, want %v", tc.name, got, tc.preferSheltered)
+		}
+	}
+}
+
+// Test that a king in the endgame scores the same for either color on the
+// same square from its own side.
+func TestKingEndgameTableSymmetric(t *testing.T) {
+	for s := Square(0); s < 64; s++ {
+		mirror := GetSquare(9-s.Row(), s.Col())
+		if KING_ENDGAME_VALUE_TABLE[s] != KING_ENDGAME_VALUE_TABLE[mirror] {
+			t.Errorf("%v is worth %v, but %v is worth %v", s, KING_ENDGAME_VALUE_TABLE[s], mirror, KING_ENDGAME_VALUE_TABLE[mirror])
+		}
+	}
+}
+
+// Test that CompoundEvaluator blends tapered evaluators the same way they
+// do on their own, and that evaluations are from the side to move.
+func TestCompoundEvaluatorTapers(t *testing.T) {
+	InitInternalData()
+	evaluators := []Evaluator{MaterialEvaluator{}, PieceSquareEvaluator{}, OpeningEvaluator{}, KingSafetyEvaluator{}, PawnStructureEvaluator{}, PassedPawnEvaluator{}}
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/5pk1/8/8/8/8/1R3PK1/r7 w - - 0 1",
+	}
+	for _, fen := range fens {
+		b, err := BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("error reading fen string %v: %v", fen, err)
+		}
+		want := 0.0
+		for _, e := range evaluators {
+			want += e.Evaluate(b)
+		}
+		got := CompoundEvaluator{Evaluators: evaluators}.Evaluate(b)
+		if math.Abs(got-want) > 1e-9 {
+			t.Errorf("%v: compound evaluation got %v, want %v", fen, got, want)
+		}
+		b.SwitchActivePlayer()
+		if other := (CompoundEvaluator{Evaluators: evaluators}).Evaluate(b); math.Abs(other+got) > 1e-9 {
+			t.Errorf("%v: evaluation with the other side to move got %v, want %v", fen, other, -got)
+		}
+	}
+}
+
+func BenchmarkEvaluators(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	evaluators := []struct {
+		name string
+		e    Evaluator
+	}{
+		{"material", MaterialEvaluator{}},
+		{"piece square", PieceSquareEvaluator{}},
+		{"opening", OpeningEvaluator{}},
+		{"king safety", KingSafetyEvaluator{}},
+		{"pawn structure", PawnStructureEvaluator{}},
+		{"passed pawns", PassedPawnEvaluator{}},
+	}
+	for _, ev := range evaluators {
+		b.Run(ev.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ev.e.Evaluate(board)
+			}
+		})
+	}
+	b.Run("pawn entry", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewPawnEntry(board)
+		}
+	})
+}
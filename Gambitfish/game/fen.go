@@ -1,10 +1,11 @@
 package game
 
 import "fmt"
+import "strconv"
 import "strings"
 
 // BoardFromFen returns a new board object created from
-// Forsyth edwards notation.
+// Forsyth edwards notation. The position must pass Validate.
 // https://en.wikipedia.org/wiki/Forsyth%E2%80%93Edwards_Notation
 func BoardFromFen(s string) (*Board, error) {
 	b := &Board{}
@@ -51,15 +52,44 @@ func BoardFromFen(s string) (*Board, error) {
 		}
 	}
 
-	// TODO(slisenberger): Add En-passant square
+	// Add the en passant square. Fen gives the square the pawn skipped
+	// over, but we keep the square the pawn landed on.
 	b.EPSquare = OFFBOARD_SQUARE
-	// TODO(slisenberger): add move count!
-	for s, p := range b.Squares {
-		if p != NULLPIECE {
-			b.Position = SetPiece(b.Position, p, Square(s))
+	if split[3] != "-" {
+		ep, err := ParseSquare(split[3])
+		switch {
+		case err != nil:
+			return nil, fmt.Errorf("invalid en passant square in fen: %v", split[3])
+		case ep.Row() == 3 && b.Active == BLACK:
+			b.EPSquare = ep + 8
+		case ep.Row() == 6 && b.Active == WHITE:
+			b.EPSquare = ep - 8
+		default:
+			return nil, fmt.Errorf("impossible en passant square in fen: %v", split[3])
 		}
 	}
-	b.Position = UpdateBitboards(b.Position)
+
+	// Add the halfmove clock and move count.
+	halfMoves, err := strconv.Atoi(split[4])
+	if err != nil || halfMoves < 0 {
+		return nil, fmt.Errorf("invalid halfmove clock in fen: %v", split[4])
+	}
+	b.HalfMoveClock = halfMoves
+	move, err := strconv.Atoi(split[5])
+	if err != nil || move < 0 {
+		return nil, fmt.Errorf("invalid move number in fen: %v", split[5])
+	}
+	// Some fens count from 0, but our boards start at move 1.
+	if move == 0 {
+		move = 1
+	}
+	b.Move = move
+	b.Hash = ZobristHash(b)
+	b.PawnHash = ZobristPawnHash(b)
+	b.Keys = []uint64{b.Hash}
+	if err := b.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid position in fen %v: %v", s, err)
+	}
 	return b, nil
 }
 
@@ -74,39 +104,39 @@ func HandleFenBoardRow(row string, b *Board, rowNum int) error {
 			continue
 		}
 		colNum += 1
-		square := GetSquare(rowNum, colNum)
+		if colNum > 8 {
+			return fmt.Errorf("fen board contained row with >8 chars: %v", row)
+		}
+		var p Piece
 		switch char {
 		case 'p':
-			b.Squares[square] = BLACKPAWN
+			p = BLACKPAWN
 		case 'P':
-			b.Squares[square] = WHITEPAWN
+			p = WHITEPAWN
 		case 'b':
-			b.Squares[square] = BLACKBISHOP
+			p = BLACKBISHOP
 		case 'B':
-			b.Squares[square] = WHITEBISHOP
+			p = WHITEBISHOP
 		case 'n':
-			b.Squares[square] = BLACKKNIGHT
+			p = BLACKKNIGHT
 		case 'N':
-			b.Squares[square] = WHITEKNIGHT
+			p = WHITEKNIGHT
 		case 'q':
-			b.Squares[square] = BLACKQUEEN
+			p = BLACKQUEEN
 		case 'Q':
-			b.Squares[square] = WHITEQUEEN
+			p = WHITEQUEEN
 		case 'k':
-			b.Squares[square] = BLACKKING
+			p = BLACKKING
 		case 'K':
-			b.Squares[square] = WHITEKING
+			p = WHITEKING
 		case 'r':
-			b.Squares[square] = BLACKROOK
+			p = BLACKROOK
 		case 'R':
-			b.Squares[square] = WHITEROOK
+			p = WHITEROOK
 		default:
 			return fmt.Errorf("fen notation has unrecognized char: %v", string(char))
 		}
-
-		if colNum > 8 {
-			return fmt.Errorf("fen board contained row with >8 chars: %v", row)
-		}
+		b.put(p, GetSquare(rowNum, colNum))
 	}
 	return nil
 }
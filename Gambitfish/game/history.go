@@ -0,0 +1,34 @@
+package game
+
+// HISTORY_MAX bounds the scores in a HistoryTable. When a score reaches it,
+// the whole table is aged so that recent cutoffs keep mattering.
+const HISTORY_MAX = 1 << 14
+
+// HistoryTable scores quiet moves by how often they caused beta cutoffs
+// anywhere in the search, indexed by piece and destination square. Unlike
+// killer moves, this carries over between plies and sibling subtrees.
+type HistoryTable [13][64]int
+
+// AddCutoff rewards a quiet move that caused a beta cutoff at depth.
+// Deeper cutoffs prune more of the tree, so they count for more.
+func (h *HistoryTable) AddCutoff(m EfficientMove, depth int) {
+	s := &h[m.Piece()][m.Square()]
+	*s += depth * depth
+	if *s >= HISTORY_MAX {
+		h.Age()
+	}
+}
+
+// Score returns how good the history table thinks m is, between 0 and 1.
+func (h *HistoryTable) Score(m EfficientMove) float64 {
+	return float64(h[m.Piece()][m.Square()]) / HISTORY_MAX
+}
+
+// Age halves every score in the table.
+func (h *HistoryTable) Age() {
+	for p := range h {
+		for s := range h[p] {
+			h[p][s] /= 2
+		}
+	}
+}
@@ -5,7 +5,7 @@ package game
 
 import "math/rand"
 import "math/bits"
-import "time"
+import "sync"
 
 // The preprocessed set of squares a piece can move to for a given
 // index.
@@ -43,6 +43,15 @@ var ZOBRISTWQS uint64
 var ZOBRISTBKS uint64
 var ZOBRISTBQS uint64
 
+// Random numbers for the file of a pawn that can be captured en passant.
+var ZOBRISTEP [8]uint64
+
+// BETWEEN[a][b] is the set of squares strictly between a and b if they
+// share a rank, file or diagonal, and empty otherwise. LINE[a][b] is the
+// whole line through both squares, edge to edge.
+var BETWEEN [64][64]uint64
+var LINE [64][64]uint64
+
 // The precomputed relevant occupancies to determine
 // blockers for ray attacks.
 var BLOCKERMASKBISHOP = [64]uint64{
@@ -85,7 +94,8 @@ var BLOCKERMASKROOK = [64]uint64{
 // The hash key for a particular square for rooks/bishops
 // in looking up precomputed moves. I tried computing these but it was
 // taking a really long time. Graciously stolen from Crafty's open source
-// engine.
+// engine. The magics command checks them against masks and attacks
+// worked out from scratch, and can find new ones.
 var MAGICNUMBERROOK = [64]uint64{
 	0x0080001020400080, 0x0040001000200040, 0x0080081000200080, 0x0080040800100080,
 	0x0080020400080080, 0x0080010200040080, 0x0080008001000200, 0x0080002040800100,
@@ -147,67 +157,27 @@ var SHIFTSIZEBISHOP = [64]uint64{
 	58, 59, 59, 59, 59, 59, 59, 58,
 }
 
-// The precomputed attack squares for bishops and rooks. Each
-// Square has a table, and each of those has a hash table indexed
-// By a magic number computation.
-var BISHOPATTACKS [64][]uint64
-var ROOKATTACKS [64][]uint64
-
 // TODO(slisenberger): include en passant in zobrist.
 
+// initOnce makes sure the tables are only built once. After that they are
+// never written to, so any number of engines can share them.
+var initOnce sync.Once
+
+// InitInternalData builds the lookup tables used by move generation and
+// hashing. It is safe to call more than once, and from several goroutines.
 func InitInternalData() {
-	// This needs to happen before magic bitboard generation
-	// because we use this as a convenience for building attack
-	// boards.
-	BuildByteLookupTable()
+	initOnce.Do(initInternalData)
+}
+
+func initInternalData() {
 	InitMagicBitboards()
 	LEGALKINGMOVES = LegalKingMovesDict()
 	LEGALKNIGHTMOVES = LegalKnightMovesDict()
 	InitPawnAttacks()
+	InitLines()
 	InitZobristNumbers()
 }
 
-// Initialize the preset arrays containing all possible
-// boards that could block rook or bishop movement, and the
-// resulting moves that can be made because of them.
-func InitMagicBitboards() {
-	// Store the magic number keys.
-	ROOKATTACKS = [64][]uint64{}
-	BISHOPATTACKS = [64][]uint64{}
-	// Get all the possible blockerboards, and their resulting
-	// legal moves.
-
-	var i uint64
-	// Loop once for rooks.
-	for i = 0; i < 64; i++ {
-		mask := BLOCKERMASKROOK[i]
-		bitCount := bits.OnesCount64(mask)
-		perms := GenerateBlockerPermutations(mask, mask)
-		rookAttacks := make([]uint64, 1<<uint64(bitCount))
-		for _, perm := range perms {
-			moves := RookMovesOnBoard(Square(i), perm)
-			key := (perm * MAGICNUMBERROOK[i]) >> uint64(64-bitCount)
-			rookAttacks[key] = moves
-		}
-		ROOKATTACKS[i] = rookAttacks
-	}
-
-	// And again for bishops.
-	for i = 0; i < 64; i++ {
-		mask := BLOCKERMASKBISHOP[i]
-		bitCount := bits.OnesCount64(mask)
-		perms := GenerateBlockerPermutations(mask, mask)
-		bishopAttacks := make([]uint64, 1<<uint64(bitCount))
-		for _, perm := range perms {
-			moves := BishopMovesOnBoard(Square(i), perm)
-			key := (perm * MAGICNUMBERBISHOP[i]) >> uint64(64-bitCount)
-			bishopAttacks[key] = moves
-		}
-		BISHOPATTACKS[i] = bishopAttacks
-	}
-
-}
-
 // Returns a set of legal moves for a rook on Square s with blockers on
 // bb.
 func RookMovesOnBoard(s Square, bb uint64) uint64 {
@@ -431,10 +401,40 @@ func InitPawnAttacks() {
 	}
 }
 
+// InitLines fills in BETWEEN and LINE by walking outwards from every
+// square in each of the eight directions.
+func InitLines() {
+	directions := [8][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+	for i := 0; i < 64; i++ {
+		from := Square(i)
+		for _, d := range directions {
+			// The line is the square itself and the rays either side of it.
+			line := uint64(1) << uint(from)
+			for r, c := from.Row()+d[0], from.Col()+d[1]; r >= 1 && r <= 8 && c >= 1 && c <= 8; r, c = r+d[0], c+d[1] {
+				line |= 1 << uint(GetSquare(r, c))
+			}
+			for r, c := from.Row()-d[0], from.Col()-d[1]; r >= 1 && r <= 8 && c >= 1 && c <= 8; r, c = r-d[0], c-d[1] {
+				line |= 1 << uint(GetSquare(r, c))
+			}
+			var between uint64
+			for r, c := from.Row()+d[0], from.Col()+d[1]; r >= 1 && r <= 8 && c >= 1 && c <= 8; r, c = r+d[0], c+d[1] {
+				to := GetSquare(r, c)
+				BETWEEN[from][to] = between
+				LINE[from][to] = line
+				between |= 1 << uint(to)
+			}
+		}
+	}
+}
+
+// ZOBRIST_SEED seeds the random numbers used to hash positions.
+const ZOBRIST_SEED = 0x6A6D62
+
 // Initializes the set of random numbers necessary to hash positions.
 // See https://chessprogramming.wikispaces.com/Zobrist+Hashing
 func InitZobristNumbers() {
-	rand.Seed(time.Now().UTC().UnixNano())
+	// The keys are the same every run, so hashes saved to disk stay valid.
+	r := rand.New(rand.NewSource(ZOBRIST_SEED))
 	ZOBRISTPIECES = [13][64]uint64{}
 	pieces := []Piece{
 		WHITEPAWN, BLACKPAWN, WHITEBISHOP, BLACKBISHOP, WHITEKNIGHT, BLACKKNIGHT,
@@ -442,18 +442,22 @@ func InitZobristNumbers() {
 	for _, p := range pieces {
 			squares := [64]uint64{}
 			for i := 0; i < 64; i++ {
-				squares[i] = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
+				squares[i] = uint64(r.Uint32())<<32 + uint64(r.Uint32())
 
 			}
 		ZOBRISTPIECES[p] = squares
 	}
-	ZOBRISTTURN = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
-	ZOBRISTWKS = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
+	ZOBRISTTURN = uint64(r.Uint32())<<32 + uint64(r.Uint32())
+	ZOBRISTWKS = uint64(r.Uint32())<<32 + uint64(r.Uint32())
+
+	ZOBRISTWQS = uint64(r.Uint32())<<32 + uint64(r.Uint32())
 
-	ZOBRISTWQS = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
+	ZOBRISTBKS = uint64(r.Uint32())<<32 + uint64(r.Uint32())
 
-	ZOBRISTBKS = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
+	ZOBRISTBQS = uint64(r.Uint32())<<32 + uint64(r.Uint32())
 
-	ZOBRISTBQS = uint64(rand.Uint32())<<32 + uint64(rand.Uint32())
+	for i := range ZOBRISTEP {
+		ZOBRISTEP[i] = uint64(r.Uint32())<<32 + uint64(r.Uint32())
+	}
 
 }
@@ -1,23 +1,51 @@
 package game
 
+import "math/bits"
+
 const FIRST_ROW_PAWN_SHIELD_VALUE = .35
 const SECOND_ROW_PAWN_SHIELD_VALUE = .15
 
-type KingSafetyEvaluator struct{}
+type KingSafetyEvaluator struct {
+	// Pawns, if not nil, caches the evaluation between positions with the
+	// same pawns and kings.
+	Pawns *PawnTable
+}
+
+func (k KingSafetyEvaluator) WithPawnTable(t *PawnTable) Evaluator {
+	k.Pawns = t
+	return k
+}
 
 // Evaluate returns an estimate of the positional safety of a king
 // according to its pawns.
 func (k KingSafetyEvaluator) Evaluate(b *Board) float64 {
+	mg, eg := k.EvaluateTapered(b)
+	return Taper(mg, eg, GamePhase(b))
+}
+
+// EvaluateTapered only scores king safety in the middlegame. In the
+// endgame the king needs to come out and fight, not hide behind pawns.
+func (k KingSafetyEvaluator) EvaluateTapered(b *Board) (mg, eg float64) {
+	if k.Pawns != nil {
+		mg = k.Pawns.Probe(b).KingSafety
+	} else {
+		mg = kingSafety(b)
+	}
+	return float64(b.Active) * mg, 0
+}
+
+// kingSafety evaluates the kings' pawn shields from white's point of view.
+func kingSafety(b *Board) float64 {
 	eval := 0.0
 	// Find the king.
 	wkbb := b.Position.WhiteKing
-	wkS := SquaresFromBitBoard(wkbb)[0]
+	wkS := LSB(wkbb)
 	bkbb := b.Position.BlackKing
 	if bkbb == 0 {
 		b.Print()
 		panic("help")
 	}
-	bkS := SquaresFromBitBoard(bkbb)[0]
+	bkS := LSB(bkbb)
 	var wkShield uint64
 	var bkShield uint64
 	// Identify the king's pawn shields.
@@ -38,11 +66,11 @@ func (k KingSafetyEvaluator) Evaluate(b *Board) float64 {
 	}
 
 	// Find and evaluate the pawns in the pawn shields.
-	wp := SquaresFromBitBoard(wkShield & b.Position.WhitePawns)
-	bp := SquaresFromBitBoard(bkShield & b.Position.BlackPawns)
+	wp := bits.OnesCount64(wkShield & b.Position.WhitePawns)
+	bp := bits.OnesCount64(bkShield & b.Position.BlackPawns)
 
-	eval += FIRST_ROW_PAWN_SHIELD_VALUE * float64(len(wp))
-	eval -= FIRST_ROW_PAWN_SHIELD_VALUE * float64(len(bp))
+	eval += FIRST_ROW_PAWN_SHIELD_VALUE * float64(wp)
+	eval -= FIRST_ROW_PAWN_SHIELD_VALUE * float64(bp)
 
 	// Now find the second rank above the king
 	if wkS.Col() == 1 {
@@ -60,11 +88,11 @@ func (k KingSafetyEvaluator) Evaluate(b *Board) float64 {
 		bkShield = bkbb>>15 | bkbb>>16 | bkbb>>17
 	}
 	// Find and evaluate the pawns one rank in front of the king.
-	wp = SquaresFromBitBoard(wkShield & b.Position.WhitePawns)
-	bp = SquaresFromBitBoard(bkShield & b.Position.BlackPawns)
+	wp = bits.OnesCount64(wkShield & b.Position.WhitePawns)
+	bp = bits.OnesCount64(bkShield & b.Position.BlackPawns)
 
-	eval += SECOND_ROW_PAWN_SHIELD_VALUE * float64(len(wp))
-	eval -= SECOND_ROW_PAWN_SHIELD_VALUE * float64(len(bp))
+	eval += SECOND_ROW_PAWN_SHIELD_VALUE * float64(wp)
+	eval -= SECOND_ROW_PAWN_SHIELD_VALUE * float64(bp)
 
 	// Find and evaluate king column
 	// This is really crude. Basically trying to promote castling if at all possible.
@@ -84,6 +112,5 @@ func (k KingSafetyEvaluator) Evaluate(b *Board) float64 {
 	// Find the pawn shields two rows in front of the king.
 	// TODO
 
-	// Return, making sure we are color appropriate.
-	return float64(b.Active) * eval
+	return eval
 }
@@ -0,0 +1,293 @@
+// legal.go generates legal moves straight from the bitboards. Instead of
+// making every pseudolegal move and checking whether it leaves the king in
+// check, we work out once per position which pieces give check and which
+// are pinned, and only generate moves that respect them.
+package game
+
+import "math/bits"
+
+// ALLSQUARES is the bitboard with every square set.
+const ALLSQUARES = ^uint64(0)
+
+// legality is what we need to know about a position to tell which moves
+// are legal without making them.
+type legality struct {
+	us, them Color
+	king     Square // OFFBOARD_SQUARE if we have no king.
+	own, opp uint64
+	occ      uint64
+	// checkers are the enemy pieces giving check.
+	checkers uint64
+	// pinned are our pieces that can only move along the line between
+	// them and our king.
+	pinned uint64
+	// checkMask is where pieces other than the king can move: anywhere
+	// when not in check, onto the checker or between it and the king in
+	// single check, and nowhere in double check.
+	checkMask uint64
+}
+
+func newLegality(b *Board) legality {
+	pos := &b.Position
+	l := legality{
+		us:        b.Active,
+		them:      -b.Active,
+		king:      OFFBOARD_SQUARE,
+		occ:       pos.Occupied,
+		checkMask: ALLSQUARES,
+	}
+	var king, rooks, bishops uint64
+	switch b.Active {
+	case WHITE:
+		l.own, l.opp = pos.WhitePieces, pos.BlackPieces
+		king = pos.WhiteKing
+		rooks = pos.BlackRooks | pos.BlackQueens
+		bishops = pos.BlackBishops | pos.BlackQueens
+	case BLACK:
+		l.own, l.opp = pos.BlackPieces, pos.WhitePieces
+		king = pos.BlackKing
+		rooks = pos.WhiteRooks | pos.WhiteQueens
+		bishops = pos.WhiteBishops | pos.WhiteQueens
+	}
+	if king == 0 {
+		return l
+	}
+	l.king = Square(bits.TrailingZeros64(king))
+	l.checkers = AttackersTo(b, l.king, l.occ, l.them)
+	switch bits.OnesCount64(l.checkers) {
+	case 0:
+	case 1:
+		l.checkMask = l.checkers | BETWEEN[l.king][bits.TrailingZeros64(l.checkers)]
+	default:
+		l.checkMask = 0
+	}
+	// A slider that would see our king through exactly one of our pieces
+	// pins it.
+	snipers := RookAttacks(l.king, 0)&rooks | BishopAttacks(l.king, 0)&bishops
+	l.pinned = singleBlockers(l.king, snipers, l.occ) & l.own
+	return l
+}
+
+// generateLegalMoves appends to moves the legal moves of the given pieces
+// that end on one of the target squares. Pawn pushes are limited to
+// pushTargets instead, so captures and promotions can be generated apart
+// from quiet moves. En passant counts as ending on the square of the
+// captured pawn.
+func (b *Board) generateLegalMoves(l *legality, moves []EfficientMove, pieces, targets, pushTargets uint64) []EfficientMove {
+	pieces &= l.own
+	king := uint64(0)
+	if l.king != OFFBOARD_SQUARE {
+		king = pieces & (1 << uint(l.king))
+		pieces &^= king
+	}
+	// In double check only the king can move, except for the odd en
+	// passant capture that deals with both checkers at once.
+	moves = b.appendEnPassants(moves, pieces, targets, l)
+	if l.checkMask == 0 {
+		pieces = 0
+	}
+	for bb := pieces; bb != 0; bb &= bb - 1 {
+		from := Square(bits.TrailingZeros64(bb))
+		p := b.Squares[from]
+		mask := l.checkMask
+		if l.pinned&(1<<uint(from)) != 0 {
+			mask &= LINE[l.king][from]
+		}
+		var atk uint64
+		switch p.Type() {
+		case PAWN:
+			moves = b.appendPawnMoves(moves, p, from, targets&mask, pushTargets&mask, l)
+			continue
+		case KNIGHT:
+			atk = LEGALKNIGHTMOVES[from]
+		case BISHOP:
+			atk = BishopAttacks(from, l.occ)
+		case ROOK:
+			atk = RookAttacks(from, l.occ)
+		case QUEEN:
+			atk = BishopAttacks(from, l.occ) | RookAttacks(from, l.occ)
+		}
+		for atk &= targets & mask &^ l.own; atk != 0; atk &= atk - 1 {
+			to := Square(bits.TrailingZeros64(atk))
+			m := NewEfficientMove(p, to, from)
+			if c := b.Squares[to]; c != NULLPIECE {
+				m = m.AddCapture(c)
+			}
+			moves = append(moves, m)
+		}
+	}
+	if king != 0 {
+		moves = b.appendKingMoves(moves, targets, l)
+	}
+	return moves
+}
+
+// promotionRank returns the rank c's pawns promote on.
+func promotionRank(c Color) uint64 {
+	if c == WHITE {
+		return 0xFF << 56
+	}
+	return 0xFF
+}
+
+// appendLoudMoves appends the legal captures and promotions.
+func (b *Board) appendLoudMoves(l *legality, moves []EfficientMove) []EfficientMove {
+	return b.generateLegalMoves(l, moves, ALLSQUARES, l.opp, promotionRank(l.us))
+}
+
+// appendQuietMoves appends the legal moves that neither capture nor
+// promote.
+func (b *Board) appendQuietMoves(l *legality, moves []EfficientMove) []EfficientMove {
+	return b.generateLegalMoves(l, moves, ALLSQUARES, ^l.occ, ^l.occ&^promotionRank(l.us))
+}
+
+// legalMove returns the legal move matching c, or 0 if c isn't legal.
+func (b *Board) legalMove(l *legality, c CompactMove) EfficientMove {
+	if c == CompactMove(0) {
+		return EfficientMove(0)
+	}
+	from := uint64(1) << (uint(c) >> 6 & 0x3F)
+	to := uint64(1) << (uint(c) & 0x3F)
+	targets := to
+	if b.EPSquare != OFFBOARD_SQUARE {
+		targets |= 1 << uint(b.EPSquare)
+	}
+	var buf [8]EfficientMove
+	for _, m := range b.generateLegalMoves(l, buf[:0], from, targets, to) {
+		if m.Compact() == c {
+			return m
+		}
+	}
+	return EfficientMove(0)
+}
+
+// LegalMove returns the legal move matching c, or 0 if c isn't legal in
+// this position. It's a cheap way to check a move from the transposition
+// table, which might belong to another position with a colliding hash.
+func (b *Board) LegalMove(c CompactMove) EfficientMove {
+	l := newLegality(b)
+	return b.legalMove(&l, c)
+}
+
+// HasLegalMove returns true if the active player has any legal move.
+func (b *Board) HasLegalMove() bool {
+	l := newLegality(b)
+	var buf [MAX_MOVES]EfficientMove
+	return len(b.generateLegalMoves(&l, buf[:0], ALLSQUARES, ALLSQUARES, ALLSQUARES)) > 0
+}
+
+// appendPawnMoves appends the captures of the pawn p on from that land on a
+// target square, and its pushes that land on a push target. En passant is
+// left to appendEnPassants.
+func (b *Board) appendPawnMoves(moves []EfficientMove, p Piece, from Square, targets, pushTargets uint64, l *legality) []EfficientMove {
+	var forward int
+	var startRow int
+	var atk uint64
+	switch l.us {
+	case WHITE:
+		forward, startRow, atk = 8, 2, WHITEPAWNATTACKS[from]
+	case BLACK:
+		forward, startRow, atk = -8, 7, BLACKPAWNATTACKS[from]
+	}
+	one := Square(int(from) + forward)
+	if l.occ&(1<<uint(one)) == 0 {
+		if pushTargets&(1<<uint(one)) != 0 {
+			moves = appendPawnMove(moves, NewEfficientMove(p, one, from))
+		}
+		// A double push can block a check the single push doesn't.
+		two := Square(int(one) + forward)
+		if from.Row() == startRow && l.occ&(1<<uint(two)) == 0 && pushTargets&(1<<uint(two)) != 0 {
+			moves = append(moves, NewEfficientMove(p, two, from).AddTwoPawnAdvance())
+		}
+	}
+	for atk &= targets & l.opp; atk != 0; atk &= atk - 1 {
+		to := Square(bits.TrailingZeros64(atk))
+		moves = appendPawnMove(moves, NewEfficientMove(p, to, from).AddCapture(b.Squares[to]))
+	}
+	return moves
+}
+
+// appendPawnMove appends a pawn move, or all four promotions if it reaches
+// the last rank.
+func appendPawnMove(moves []EfficientMove, m EfficientMove) []EfficientMove {
+	if to := m.Square(); to.Row() != 1 && to.Row() != 8 {
+		return append(moves, m)
+	}
+	// Black pieces are numbered six after the white ones.
+	offset := Piece(0)
+	if m.Piece().Color() == BLACK {
+		offset = BLACKPAWN - WHITEPAWN
+	}
+	for _, p := range [4]Piece{WHITEQUEEN, WHITEROOK, WHITEBISHOP, WHITEKNIGHT} {
+		moves = append(moves, m.AddPromotion(p+offset))
+	}
+	return moves
+}
+
+// appendEnPassants appends the legal en passant captures by the given
+// pieces, if the captured pawn's square is a target. Capturing en passant takes two pieces off a
+// rank at once, which can expose the king in ways pins don't describe, so
+// we check the king's safety on the resulting occupancy instead.
+func (b *Board) appendEnPassants(moves []EfficientMove, pieces, targets uint64, l *legality) []EfficientMove {
+	ep := b.EPSquare
+	if ep == OFFBOARD_SQUARE || targets&(1<<uint(ep)) == 0 || l.king == OFFBOARD_SQUARE {
+		return moves
+	}
+	captured := b.Squares[ep]
+	if captured.Type() != PAWN || captured.Color() != l.them {
+		return moves
+	}
+	var to Square
+	var from uint64
+	switch l.us {
+	case WHITE:
+		to = ep + 8
+		from = BLACKPAWNATTACKS[to] & b.Position.WhitePawns
+	case BLACK:
+		to = ep - 8
+		from = WHITEPAWNATTACKS[to] & b.Position.BlackPawns
+	}
+	from &= pieces
+	for ; from != 0; from &= from - 1 {
+		s := Square(bits.TrailingZeros64(from))
+		occ := l.occ ^ 1<<uint(s) ^ 1<<uint(to) ^ 1<<uint(ep)
+		if AttackersTo(b, l.king, occ, l.them)&^(1<<uint(ep)) != 0 {
+			continue
+		}
+		moves = append(moves, NewEfficientMove(b.Squares[s], to, s).AddEnPassant().AddCapture(captured))
+	}
+	return moves
+}
+
+// appendKingMoves appends the king's moves to squares the enemy doesn't
+// attack, and castling when it's allowed.
+func (b *Board) appendKingMoves(moves []EfficientMove, targets uint64, l *legality) []EfficientMove {
+	if l.king == OFFBOARD_SQUARE {
+		return moves
+	}
+	k := b.Squares[l.king]
+	// Take the king off the board, so it can't hide behind itself from a
+	// slider checking it.
+	occ := l.occ &^ (1 << uint(l.king))
+	for atk := LEGALKINGMOVES[l.king] & targets &^ l.own; atk != 0; atk &= atk - 1 {
+		to := Square(bits.TrailingZeros64(atk))
+		if AttackersTo(b, to, occ, l.them) != 0 {
+			continue
+		}
+		m := NewEfficientMove(k, to, l.king)
+		if c := b.Squares[to]; c != NULLPIECE {
+			m = m.AddCapture(c)
+		}
+		moves = append(moves, m)
+	}
+	if l.checkers != 0 {
+		return moves
+	}
+	if to := l.king + 2; targets&(1<<uint(to)) != 0 && CanCastleKingside(b, l.us) {
+		moves = append(moves, NewEfficientMove(k, to, l.king).AddKSCastle())
+	}
+	if to := l.king - 2; targets&(1<<uint(to)) != 0 && CanCastleQueenside(b, l.us) {
+		moves = append(moves, NewEfficientMove(k, to, l.king).AddQSCastle())
+	}
+	return moves
+}
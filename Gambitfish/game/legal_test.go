@@ -0,0 +1,141 @@
+package game
+
+import "sort"
+import "testing"
+
+// makeTestMoves returns the legal moves found the slow way: making every
+// pseudolegal move and checking whether it leaves the king in check.
+func makeTestMoves(b *Board) []EfficientMove {
+	var moves []EfficientMove
+	for s, p := range b.Squares {
+		if p == NULLPIECE || p.Color() != b.Active {
+			continue
+		}
+		for _, m := range LegalMoves(b, p, Square(s)) {
+			bs := ApplyMove(b, m)
+			if !IsCheck(b, b.Active) {
+				moves = append(moves, m)
+			}
+			UndoMove(b, m, bs)
+		}
+	}
+	return moves
+}
+
+func sortedMoves(moves []EfficientMove) []EfficientMove {
+	sorted := append([]EfficientMove(nil), moves...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// Test that generating legal moves from pins and checks agrees with making
+// and testing every move, in every position a couple of plies deep.
+func TestLegalMovesMatchMakeTest(t *testing.T) {
+	InitInternalData()
+	fens := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 0",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+	var walk func(b *Board, depth int, name string)
+	walk = func(b *Board, depth int, name string) {
+		got := sortedMoves(b.AllLegalMoves())
+		want := sortedMoves(makeTestMoves(b))
+		if len(got) != len(want) {
+			t.Errorf("%v: got %v legal moves %v, want %v %v", name, len(got), got, len(want), want)
+			return
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%v: got legal move %v, want %v", name, got[i], want[i])
+				return
+			}
+		}
+		if depth == 0 {
+			return
+		}
+		for _, m := range got {
+			bs := ApplyMove(b, m)
+			b.SwitchActivePlayer()
+			walk(b, depth-1, name+" "+m.String())
+			UndoMove(b, m, bs)
+			b.SwitchActivePlayer()
+		}
+	}
+	for _, fen := range fens {
+		b, err := BoardFromFen(fen)
+		if err != nil {
+			t.Fatalf("error reading fen string %v: %v", fen, err)
+		}
+		walk(b, 2, fen)
+	}
+}
+
+// Test the positions where pins and checks are easiest to get wrong.
+func TestLegalMovesPinsAndChecks(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name  string
+		fen   string
+		ep    Square // BoardFromFen doesn't read the en passant square.
+		moves int
+	}{
+		{
+			name:  "en passant would expose the king along the rank",
+			fen:   "8/8/8/KPp4r/8/8/8/7k w - c6 0 1",
+			ep:    C5,
+			moves: 4,
+		}, {
+			name:  "en passant captures the checking pawn",
+			fen:   "8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1",
+			ep:    D4,
+			moves: 9,
+		}, {
+			name:  "double check leaves only king moves",
+			fen:   "4k3/8/8/8/8/5n2/8/r3K3 w - - 0 1",
+			ep:    OFFBOARD_SQUARE,
+			moves: 2,
+		}, {
+			name:  "pinned rook can slide along the pin",
+			fen:   "4r2k/8/8/8/8/8/4R3/4K3 w - - 0 1",
+			ep:    OFFBOARD_SQUARE,
+			moves: 10,
+		},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.fen, err)
+		}
+		b.SetEPSquare(tc.ep)
+		if got := b.AllLegalMoves(); len(got) != tc.moves {
+			t.Errorf("%v: got %v legal moves %v, want %v", tc.name, len(got), got, tc.moves)
+		}
+	}
+}
+
+func BenchmarkAllLegalMoves(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		board.AllLegalMoves()
+	}
+}
+
+func BenchmarkMakeTestMoves(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		makeTestMoves(board)
+	}
+}
@@ -0,0 +1,165 @@
+// magic.go finds, checks and builds the magic bitboard tables that slider
+// attacks are looked up in.
+// See https://www.chessprogramming.org/Magic_Bitboards
+package game
+
+import "fmt"
+import "math/bits"
+import "math/rand"
+
+// Magic is what it takes to look up the attacks of a slider on one square.
+// The occupied squares of Mask, multiplied by Number and shifted right by
+// Shift, give an index into that square's part of SLIDERATTACKS, which
+// starts at Offset.
+type Magic struct {
+	Mask   uint64
+	Number uint64
+	Shift  uint64
+	Offset uint64
+}
+
+// Index returns where the attacks for the occupied squares occ are, from
+// the start of the square's table.
+func (m *Magic) Index(occ uint64) uint64 {
+	return ((occ & m.Mask) * m.Number) >> m.Shift
+}
+
+// Size is how many entries the square's table has.
+func (m *Magic) Size() uint64 {
+	return 1 << (64 - m.Shift)
+}
+
+var ROOKMAGICS [64]Magic
+var BISHOPMAGICS [64]Magic
+
+// SLIDERATTACKS holds the attacks of every square's rooks and bishops, one
+// table after another, so that they share a single allocation.
+var SLIDERATTACKS []uint64
+
+// InitMagicBitboards builds SLIDERATTACKS from the blocker masks, magic
+// numbers and shifts in internal.go. It panics if a magic number maps two
+// occupancies with different attacks to the same entry, which would make
+// every lookup through it suspect.
+func InitMagicBitboards() {
+	var offset uint64
+	for s := 0; s < 64; s++ {
+		ROOKMAGICS[s] = Magic{BLOCKERMASKROOK[s], MAGICNUMBERROOK[s], SHIFTSIZEROOK[s], offset}
+		offset += ROOKMAGICS[s].Size()
+	}
+	for s := 0; s < 64; s++ {
+		BISHOPMAGICS[s] = Magic{BLOCKERMASKBISHOP[s], MAGICNUMBERBISHOP[s], SHIFTSIZEBISHOP[s], offset}
+		offset += BISHOPMAGICS[s].Size()
+	}
+	SLIDERATTACKS = make([]uint64, offset)
+	fill := func(s Square, m *Magic, attacks func(Square, uint64) uint64) {
+		table := SLIDERATTACKS[m.Offset : m.Offset+m.Size()]
+		if err := fillMagicTable(s, m, attacks, table); err != nil {
+			panic(err)
+		}
+	}
+	for s := Square(0); s < 64; s++ {
+		fill(s, &ROOKMAGICS[s], RookMovesOnBoard)
+		fill(s, &BISHOPMAGICS[s], BishopMovesOnBoard)
+	}
+}
+
+// fillMagicTable stores the attacks for every occupancy of m's mask in
+// table, and returns an error if two of them collide.
+func fillMagicTable(s Square, m *Magic, attacks func(Square, uint64) uint64, table []uint64) error {
+	// A slider always attacks at least one square, so an empty entry is
+	// one that hasn't been filled yet.
+	for i := range table {
+		table[i] = 0
+	}
+	// Enumerate the subsets of the mask with the carry-rippler trick.
+	occ := uint64(0)
+	for {
+		atk := attacks(s, occ)
+		i := m.Index(occ)
+		if table[i] != 0 && table[i] != atk {
+			return fmt.Errorf("magic %#016x for %v maps %#016x onto a different occupancy", m.Number, s, occ)
+		}
+		table[i] = atk
+		occ = (occ - m.Mask) & m.Mask
+		if occ == 0 {
+			return nil
+		}
+	}
+}
+
+// VerifyMagic returns an error if looking up the attacks from s through m
+// gives anything other than attacks for some occupancy of m's mask, or if
+// the mask isn't the one for the piece.
+func VerifyMagic(s Square, m Magic, mask uint64, attacks func(Square, uint64) uint64) error {
+	if m.Mask != mask {
+		return fmt.Errorf("%v has mask %#016x, want %#016x", s, m.Mask, mask)
+	}
+	if want := uint64(64 - bits.OnesCount64(mask)); m.Shift != want {
+		return fmt.Errorf("%v has shift %v, want %v", s, m.Shift, want)
+	}
+	return fillMagicTable(s, &m, attacks, make([]uint64, m.Size()))
+}
+
+// RookMask returns the squares whose occupancy changes where a rook on s
+// can go: its rays on an empty board, less the last square of each.
+func RookMask(s Square) uint64 {
+	const rank1, rank8 = uint64(0xFF), uint64(0xFF) << 56
+	const fileA, fileH = uint64(0x0101010101010101), uint64(0x8080808080808080)
+	file := RookMovesOnBoard(s, 0) & (fileA << uint(s.Col()-1))
+	rank := RookMovesOnBoard(s, 0) & (rank1 << uint(8*(s.Row()-1)))
+	return file&^(rank1|rank8) | rank&^(fileA|fileH)
+}
+
+// BishopMask returns the squares whose occupancy changes where a bishop on
+// s can go: its diagonals on an empty board, less the edges.
+func BishopMask(s Square) uint64 {
+	const edges = uint64(0xFF818181818181FF)
+	return BishopMovesOnBoard(s, 0) &^ edges
+}
+
+// MAX_MAGIC_TRIES is how many candidates FindMagic tries before giving up.
+const MAX_MAGIC_TRIES = 100000000
+
+// FindMagic searches for a magic number that maps every occupancy of mask
+// to a collision-free index of 64 - popcount(mask) bits.
+func FindMagic(s Square, mask uint64, attacks func(Square, uint64) uint64, r *rand.Rand) (Magic, error) {
+	n := bits.OnesCount64(mask)
+	m := Magic{Mask: mask, Shift: uint64(64 - n)}
+	// Work out every occupancy and its attacks once, up front.
+	occs := make([]uint64, 0, 1<<uint(n))
+	atks := make([]uint64, 0, 1<<uint(n))
+	for occ := uint64(0); ; {
+		occs = append(occs, occ)
+		atks = append(atks, attacks(s, occ))
+		occ = (occ - mask) & mask
+		if occ == 0 {
+			break
+		}
+	}
+	// Entries are stamped with the try that filled them, so the table
+	// doesn't need clearing between tries.
+	table := make([]uint64, m.Size())
+	stamps := make([]int, m.Size())
+	for try := 1; try <= MAX_MAGIC_TRIES; try++ {
+		// Magics with few bits set tend to work.
+		m.Number = r.Uint64() & r.Uint64() & r.Uint64()
+		if bits.OnesCount64((mask*m.Number)>>56) < 6 {
+			continue
+		}
+		ok := true
+		for i, occ := range occs {
+			j := m.Index(occ)
+			if stamps[j] != try {
+				stamps[j] = try
+				table[j] = atks[i]
+			} else if table[j] != atks[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return m, nil
+		}
+	}
+	return m, fmt.Errorf("no magic found for %v in %v tries", s, MAX_MAGIC_TRIES)
+}
@@ -0,0 +1,49 @@
+package game
+
+import "math/rand"
+import "testing"
+
+// Test that the magic numbers in internal.go are right for masks and
+// shifts worked out from scratch.
+func TestBuiltInMagics(t *testing.T) {
+	InitInternalData()
+	for s := Square(0); s < 64; s++ {
+		if err := VerifyMagic(s, ROOKMAGICS[s], RookMask(s), RookMovesOnBoard); err != nil {
+			t.Errorf("rook: %v", err)
+		}
+		if err := VerifyMagic(s, BISHOPMAGICS[s], BishopMask(s), BishopMovesOnBoard); err != nil {
+			t.Errorf("bishop: %v", err)
+		}
+	}
+}
+
+func TestFindMagic(t *testing.T) {
+	InitInternalData()
+	r := rand.New(rand.NewSource(1))
+	for _, s := range []Square{A1, D4, H7} {
+		m, err := FindMagic(s, RookMask(s), RookMovesOnBoard, r)
+		if err != nil {
+			t.Fatalf("rook: %v", err)
+		}
+		if err := VerifyMagic(s, m, RookMask(s), RookMovesOnBoard); err != nil {
+			t.Errorf("rook: found a bad magic: %v", err)
+		}
+		m, err = FindMagic(s, BishopMask(s), BishopMovesOnBoard, r)
+		if err != nil {
+			t.Fatalf("bishop: %v", err)
+		}
+		if err := VerifyMagic(s, m, BishopMask(s), BishopMovesOnBoard); err != nil {
+			t.Errorf("bishop: found a bad magic: %v", err)
+		}
+	}
+}
+
+// Test that a wrong magic number is caught.
+func TestVerifyMagicCollision(t *testing.T) {
+	InitInternalData()
+	m := ROOKMAGICS[D4]
+	m.Number = 1
+	if err := VerifyMagic(D4, m, RookMask(D4), RookMovesOnBoard); err == nil {
+		t.Errorf("got no error for magic number 1")
+	}
+}
@@ -1,19 +1,22 @@
 package game
 
+import "math/bits"
+
 type MaterialEvaluator struct{}
 
 // Evaluates a board by counting the material weights for all remaining pieces.
 func (m MaterialEvaluator) Evaluate(b *Board) float64 {
-	eval := 0.0
-	for _, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		if p.Color() == b.Active  {
-			eval += p.Value()
-		} else {
-			eval -= p.Value()
-		}
-	}
-	return eval
+	pos := &b.Position
+	eval := materialDiff(pos.WhitePawns, pos.BlackPawns, WHITEPAWN) +
+		materialDiff(pos.WhiteKnights, pos.BlackKnights, WHITEKNIGHT) +
+		materialDiff(pos.WhiteBishops, pos.BlackBishops, WHITEBISHOP) +
+		materialDiff(pos.WhiteRooks, pos.BlackRooks, WHITEROOK) +
+		materialDiff(pos.WhiteQueens, pos.BlackQueens, WHITEQUEEN)
+	return float64(b.Active) * eval
+}
+
+// materialDiff returns how much more of piece p white has than black,
+// counting the pieces on each side's bitboard.
+func materialDiff(white, black uint64, p Piece) float64 {
+	return float64(bits.OnesCount64(white)-bits.OnesCount64(black)) * p.Value()
 }
@@ -2,8 +2,6 @@ package game
 
 import "fmt"
 
-import "sort"
-
 // Moves have Pieces and squares
 type Move struct {
 	Piece           Piece
@@ -155,6 +153,36 @@ func (e EfficientMove) QSCastle() bool {
 	return (e & 0x00000010 >> 4) == 1
 }
 
+// CompactMove is a move squeezed into 16 bits for the transposition table.
+// Bit map:
+// 1-6: New square
+// 7-12: Old square
+// 13-15: Promotion piece type
+// The remaining details of the move are recovered by matching it against
+// the legal moves of the position.
+type CompactMove uint16
+
+// Compact returns the move as a CompactMove.
+func (e EfficientMove) Compact() CompactMove {
+	if e == EfficientMove(0) {
+		return CompactMove(0)
+	}
+	return CompactMove(uint16(e.Square()) | uint16(e.Old())<<6 | uint16(e.Promotion().Type())<<12)
+}
+
+// Resolve finds the legal move matching c, or returns 0 if c isn't one of
+// them.
+func (c CompactMove) Resolve(moves []EfficientMove) EfficientMove {
+	if c == CompactMove(0) {
+		return EfficientMove(0)
+	}
+	for _, m := range moves {
+		if m.Compact() == c {
+			return m
+		}
+	}
+	return EfficientMove(0)
+}
 
 func (m Move) String() string {
 	var s string
@@ -228,59 +256,3 @@ type MoveRank struct {
 	Move EfficientMove
 	Score float64
 }
-
-// Order the moves in an intelligent way for alpha beta pruning.
-func OrderMoves(b *Board, moves []EfficientMove, depth int, km KillerMoves, q bool) []EfficientMove {
-
-	var k [2]EfficientMove
-	if km != nil {
-		k = km.GetKillerMoves(depth)
-	} else {
-		k = [2]EfficientMove{0, 0}
-	}
-	// Loop through the move list the rest of the times for other orderings.
-	// Score constants
-	captureScore := 1000.0
-	km1Score := 1000.0
-	km2Score := 999.0
-	bestMoveScore := 2000.0
-	e := PieceSquareEvaluator{}
-	// Start with what we already believe the best move is.
-	bestMove := EfficientMove(0)
-	// Don't use transposition table in Quiescence search.
-	if entry, ok := TranspositionTable[ZobristHash(b)]; ok && !q && entry.BestMove != EfficientMove(0) {
-		bestMove = entry.BestMove
-	}
-	moveScores := make(map[EfficientMove]float64, len(moves))
-
-	for i := 0; i < len(moves); i++ {
-		m := moves[i]
-		if m == bestMove {
-			moveScores[m] = bestMoveScore
-			continue
-		}
-		if m.Capture() != NULLPIECE {
-			moveScores[m] = captureScore + (10 * m.Capture().Value()) - m.Piece().Value()
-			continue
-		} else {
-
-			// If it's a killer move, order it highly.
-			if k[0] != EfficientMove(0) && k[0] == m {
-				moveScores[m] = km1Score
-				continue
-			}
-			if k[1] != EfficientMove(0) && k[1] == m {
-				moveScores[m] = km2Score
-				continue
-			}
-			// Order non captures by piece value weights.
-			bs := ApplyMove(b, m)
-			moveScores[m] = e.Evaluate(b)
-	          	UndoMove(b, m, bs)
-		}
-	}
-	sort.Slice(moves, func(i, j int) bool {
-		return moveScores[moves[i]] > moveScores[moves[j]]
-	})
-	return moves
-}
@@ -0,0 +1,224 @@
+// movepicker.go hands out the moves of a position one at a time, best
+// first, generating and sorting them only as the search asks for them.
+package game
+
+// MAX_MOVES is more than the number of legal moves in any chess position.
+const MAX_MOVES = 256
+
+type pickerStage int
+
+const (
+	stageHashMove = pickerStage(iota)
+	stageGenerateLoud
+	stageGoodLoud
+	stageKillers
+	stageGenerateQuiet
+	stageQuiet
+	stageBadLoud
+	stageDone
+)
+
+// MovePicker yields the legal moves of a position in stages: the hash move,
+// good captures and promotions, killer moves, quiet moves and finally
+// captures that give up material. A beta cutoff usually comes early, and
+// then the later stages are never generated at all.
+//
+// A picker keeps its moves in fixed-size arrays, so it doesn't allocate.
+// Searches keep one per ply and Init it at every node. The board must be
+// in the same position whenever Next is called.
+type MovePicker struct {
+	b          *Board
+	l          legality
+	stage      pickerStage
+	quiescence bool
+	hashMove   EfficientMove
+	killers    [MAX_KILLER_MOVES]EfficientMove
+	history    *HistoryTable
+
+	// ci is worked out the first time it's needed, as most nodes never
+	// ask which moves give check.
+	ci      checkInfo
+	ciReady bool
+
+	moves  [MAX_MOVES]EfficientMove
+	scores [MAX_MOVES]float64
+	// cur and end bound the moves of the current stage that haven't been
+	// picked yet. Bad captures are set aside at the start of the array,
+	// below bad.
+	cur, end int
+	bad      int
+	killer   int
+}
+
+// Init prepares the picker to yield every legal move of b. hashMove must
+// be legal or 0, and killers and h may be empty.
+func (p *MovePicker) Init(b *Board, hashMove EfficientMove, killers [MAX_KILLER_MOVES]EfficientMove, h *HistoryTable) {
+	p.b = b
+	p.l = newLegality(b)
+	p.ciReady = false
+	p.stage = stageHashMove
+	p.quiescence = false
+	p.hashMove = hashMove
+	p.killers = killers
+	p.history = h
+	p.cur, p.end, p.bad, p.killer = 0, 0, 0, 0
+}
+
+// InitQuiescence prepares the picker to yield the moves worth searching in
+// quiescence search: every move when in check, and otherwise captures,
+// promotions and checks.
+func (p *MovePicker) InitQuiescence(b *Board) {
+	p.Init(b, EfficientMove(0), [MAX_KILLER_MOVES]EfficientMove{}, nil)
+	p.quiescence = true
+}
+
+// InCheck returns true if the side to move is in check.
+func (p *MovePicker) InCheck() bool {
+	return p.l.checkers != 0
+}
+
+// GivesCheck returns true if m, a legal move of the picker's board, gives
+// check.
+func (p *MovePicker) GivesCheck(m EfficientMove) bool {
+	if !p.ciReady {
+		p.ci = newCheckInfo(p.b)
+		p.ciReady = true
+	}
+	return p.ci.givesCheck(p.b, m)
+}
+
+// Next returns the next move, or 0 when there are none left.
+func (p *MovePicker) Next() EfficientMove {
+	for {
+		switch p.stage {
+		case stageHashMove:
+			p.stage++
+			if p.hashMove != EfficientMove(0) {
+				return p.hashMove
+			}
+		case stageGenerateLoud:
+			p.end = len(p.b.appendLoudMoves(&p.l, p.moves[:0]))
+			for i := 0; i < p.end; i++ {
+				p.scores[i] = loudScore(p.moves[i])
+			}
+			p.stage++
+		case stageGoodLoud:
+			for p.cur < p.end {
+				m := p.pickBest()
+				if m == p.hashMove {
+					continue
+				}
+				// Quiescence search wants every capture, so only the main
+				// search puts off the bad ones.
+				if !p.quiescence && isBadCapture(m) {
+					p.moves[p.bad] = m
+					p.bad++
+					continue
+				}
+				return m
+			}
+			p.stage++
+		case stageKillers:
+			for p.killer < MAX_KILLER_MOVES {
+				k := p.killers[p.killer]
+				p.killer++
+				if k == EfficientMove(0) || k == p.hashMove || k.Capture() != NULLPIECE {
+					continue
+				}
+				// Killers come from other positions, so they might not be
+				// legal in this one.
+				if p.b.legalMove(&p.l, k.Compact()) == k {
+					return k
+				}
+			}
+			p.stage++
+		case stageGenerateQuiet:
+			p.cur = p.end
+			p.end = p.cur + len(p.b.appendQuietMoves(&p.l, p.moves[p.cur:p.cur]))
+			if p.quiescence && !p.InCheck() {
+				p.end = p.cur + p.keepChecks(p.cur, p.end)
+			}
+			for i := p.cur; i < p.end; i++ {
+				p.scores[i] = quietScore(p.moves[i], p.history)
+			}
+			p.stage++
+		case stageQuiet:
+			for p.cur < p.end {
+				m := p.pickBest()
+				if m == p.hashMove || m == p.killers[0] || m == p.killers[1] {
+					continue
+				}
+				return m
+			}
+			p.stage++
+			p.cur = 0
+		case stageBadLoud:
+			// These were set aside in order, best first.
+			if p.cur < p.bad {
+				p.cur++
+				return p.moves[p.cur-1]
+			}
+			p.stage++
+		case stageDone:
+			return EfficientMove(0)
+		}
+	}
+}
+
+// pickBest moves the best scoring move left in the stage to the front, and
+// returns it.
+func (p *MovePicker) pickBest() EfficientMove {
+	best := p.cur
+	for i := p.cur + 1; i < p.end; i++ {
+		if p.scores[i] > p.scores[best] {
+			best = i
+		}
+	}
+	p.moves[p.cur], p.moves[best] = p.moves[best], p.moves[p.cur]
+	p.scores[p.cur], p.scores[best] = p.scores[best], p.scores[p.cur]
+	p.cur++
+	return p.moves[p.cur-1]
+}
+
+// keepChecks throws away the moves between start and end that don't give
+// check, and returns how many are left.
+func (p *MovePicker) keepChecks(start, end int) int {
+	n := 0
+	for i := start; i < end; i++ {
+		if m := p.moves[i]; p.GivesCheck(m) {
+			p.moves[start+n] = m
+			n++
+		}
+	}
+	return n
+}
+
+// loudScore orders captures most valuable victim first, then least
+// valuable attacker. Promotions count as capturing the promoted piece.
+func loudScore(m EfficientMove) float64 {
+	score := 10*m.Capture().Value() - m.Piece().Value()
+	if m.Promotion() != NULLPIECE {
+		score += 10 * m.Promotion().Value()
+	}
+	return score
+}
+
+// isBadCapture returns true if m captures a less valuable piece than the
+// one capturing, and so might lose material if the victim is defended.
+// The king can only capture undefended pieces.
+func isBadCapture(m EfficientMove) bool {
+	if m.Promotion() != NULLPIECE || m.Piece().Type() == KING {
+		return false
+	}
+	return m.Capture().Value() < m.Piece().Value()
+}
+
+// quietScore orders quiet moves by how much they improve the piece's
+// square, breaking ties with moves that caused cutoffs elsewhere.
+func quietScore(m EfficientMove, h *HistoryTable) float64 {
+	score := pieceSquareValue(m.Piece(), m.Square()) - pieceSquareValue(m.Piece(), m.Old())
+	if h != nil {
+		score += h.Score(m)
+	}
+	return score
+}
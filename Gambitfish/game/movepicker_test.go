@@ -0,0 +1,218 @@
+package game
+
+import "testing"
+
+// pickAll returns every move the picker hands out, in order.
+func pickAll(p *MovePicker) []EfficientMove {
+	var moves []EfficientMove
+	for m := p.Next(); m != EfficientMove(0); m = p.Next() {
+		moves = append(moves, m)
+	}
+	return moves
+}
+
+// Test that the picker hands out every legal move exactly once, in stages:
+// the hash move, good captures, killers, quiet moves and bad captures.
+func TestMovePicker(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name    string
+		fen     string
+		hash    string // The hash move, if any.
+		killers [2]string
+		bad     string // A bad capture, if any, which should come late.
+	}{
+		{
+			name: "starting board",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			hash: "Pe2-e4",
+		}, {
+			name:    "kiwipete",
+			fen:     "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0",
+			hash:    "Be2xa6",
+			killers: [2]string{"O-O", "Pa2-a3"},
+			bad:     "Qf3xf6",
+		}, {
+			name: "promotion-antics",
+			fen:  "rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.fen, err)
+		}
+		legal := b.AllLegalMoves()
+		find := func(s string) EfficientMove {
+			for _, m := range legal {
+				if m.String() == s {
+					return m
+				}
+			}
+			return EfficientMove(0)
+		}
+		hash := find(tc.hash)
+		killers := [2]EfficientMove{find(tc.killers[0]), find(tc.killers[1])}
+		var p MovePicker
+		p.Init(b, hash, killers, &HistoryTable{})
+		got := pickAll(&p)
+		if len(got) != len(legal) {
+			t.Errorf("%v: got %v moves %v, want %v %v", tc.name, len(got), got, len(legal), legal)
+			continue
+		}
+		seen := make(map[EfficientMove]bool)
+		for _, m := range got {
+			if seen[m] {
+				t.Errorf("%v: got %v twice", tc.name, m)
+			}
+			seen[m] = true
+		}
+		for _, m := range legal {
+			if !seen[m] {
+				t.Errorf("%v: never got %v", tc.name, m)
+			}
+		}
+		if hash != EfficientMove(0) && got[0] != hash {
+			t.Errorf("%v: got first move %v, want hash move %v", tc.name, got[0], hash)
+		}
+		// After the hash move, the stages never go backwards.
+		stage := func(m EfficientMove) int {
+			switch {
+			case m.Capture() != NULLPIECE && isBadCapture(m):
+				return 3
+			case m.Capture() != NULLPIECE || m.Promotion() != NULLPIECE:
+				return 0
+			case m == killers[0] || m == killers[1]:
+				return 1
+			}
+			return 2
+		}
+		rest := got
+		if hash != EfficientMove(0) {
+			rest = got[1:]
+		}
+		for i := 1; i < len(rest); i++ {
+			if stage(rest[i]) < stage(rest[i-1]) {
+				t.Errorf("%v: got %v after %v, out of stage order", tc.name, rest[i], rest[i-1])
+			}
+		}
+		// The killers come right after the last good capture, in order.
+		lastGood := -1
+		for i, m := range rest {
+			if stage(m) == 0 {
+				lastGood = i
+			}
+		}
+		for i, k := range killers {
+			if k == EfficientMove(0) {
+				continue
+			}
+			if j := lastGood + 1 + i; j >= len(rest) || rest[j] != k {
+				t.Errorf("%v: killer %v isn't right after the good captures in %v", tc.name, k, rest)
+			}
+		}
+		// The bad capture comes after every quiet move.
+		if bad := find(tc.bad); bad != EfficientMove(0) {
+			lastQuiet, badAt := -1, -1
+			for i, m := range rest {
+				if stage(m) == 2 {
+					lastQuiet = i
+				}
+				if m == bad {
+					badAt = i
+				}
+			}
+			if badAt < lastQuiet {
+				t.Errorf("%v: got bad capture %v before quiet move %v", tc.name, bad, rest[lastQuiet])
+			}
+			if last := got[len(got)-1]; stage(last) != 3 {
+				t.Errorf("%v: got last move %v, want a bad capture", tc.name, last)
+			}
+		}
+	}
+}
+
+// Test that killer moves illegal in the position are skipped.
+func TestMovePickerIllegalKiller(t *testing.T) {
+	InitInternalData()
+	b := DefaultBoard()
+	killer := NewEfficientMove(WHITEQUEEN, H5, D1)
+	var p MovePicker
+	p.Init(b, EfficientMove(0), [2]EfficientMove{killer, EfficientMove(0)}, nil)
+	for _, m := range pickAll(&p) {
+		if m == killer {
+			t.Errorf("got illegal killer move %v", m)
+		}
+	}
+}
+
+// Test that quiescence search gets captures, promotions and checks, or
+// everything when in check.
+func TestMovePickerQuiescence(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		want int
+	}{
+		{
+			name: "quiet start has nothing to search",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			want: 0,
+		}, {
+			name: "knight checks",
+			fen:  "4k3/8/8/3p4/4N3/8/8/4K3 w - - 0 1",
+			want: 2,
+		}, {
+			name: "every evasion in check",
+			fen:  "4k3/8/8/8/8/8/8/r3K3 w - - 0 1",
+			want: 3,
+		},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen string %v: %v", tc.name, tc.fen, err)
+		}
+		var p MovePicker
+		p.InitQuiescence(b)
+		if got := pickAll(&p); len(got) != tc.want {
+			t.Errorf("%v: got %v moves %v, want %v", tc.name, len(got), got, tc.want)
+		}
+	}
+}
+
+// Test that picking moves doesn't allocate.
+func TestMovePickerAllocations(t *testing.T) {
+	InitInternalData()
+	b, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		t.Fatalf("error reading fen string: %v", err)
+	}
+	p := &MovePicker{}
+	h := &HistoryTable{}
+	allocs := testing.AllocsPerRun(100, func() {
+		p.Init(b, EfficientMove(0), [2]EfficientMove{}, h)
+		for m := p.Next(); m != EfficientMove(0); m = p.Next() {
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("picking every move allocated %v times, want 0", allocs)
+	}
+}
+
+func BenchmarkMovePicker(b *testing.B) {
+	InitInternalData()
+	board, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		b.Fatalf("error reading fen string: %v", err)
+	}
+	p := &MovePicker{}
+	h := &HistoryTable{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Init(board, EfficientMove(0), [2]EfficientMove{}, h)
+		for m := p.Next(); m != EfficientMove(0); m = p.Next() {
+		}
+	}
+}
@@ -2,6 +2,8 @@
 // development in the opening.
 package game
 
+import "math/bits"
+
 type OpeningEvaluator struct{}
 
 // centerAttackingWeights is an array of the bonus an attacked square
@@ -23,18 +25,25 @@ var wStartBishops = uint64(0x00000000000000FF)
 var bStartKnights = uint64(0xFF00000000000000)
 var wStartKnights = uint64(0x00000000000000FF)
 
+func (m OpeningEvaluator) Evaluate(b *Board) float64 {
+	mg, eg := m.EvaluateTapered(b)
+	return Taper(mg, eg, GamePhase(b))
+}
+
 // Evaluates a board in a couple ways that encourage good opening play:
 // 1. Gives a slight bonus for the number of pieces attacking the center.
 // 2. Gives a slight negative for the number of knights/bishops on their
 // starting squares.
-func (m OpeningEvaluator) Evaluate(b *Board) float64 {
+// These only apply to the middlegame score, so they fade out as pieces
+// are traded.
+func (m OpeningEvaluator) EvaluateTapered(b *Board) (mg, eg float64) {
 	res := 0.0
 	// For every piece, calculate its attacks, and add the values.
-	for cur, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		for _, s := range SquaresFromBitBoard(AttackBitboard(b, p, Square(cur))) {
+	for occ := b.Position.Occupied; occ != 0; {
+		cur := PopLSB(&occ)
+		p := b.Squares[cur]
+		for atk := AttackBitboard(b, p, cur); atk != 0; {
+			s := PopLSB(&atk)
 			if p.Color() == WHITE {
 				res += centerAttackingWeights[s]
 			} else {
@@ -45,21 +54,21 @@ func (m OpeningEvaluator) Evaluate(b *Board) float64 {
 	// Penalize knights and bishops on starting squares.
 	var startPenalty = .35
 	if (wStartBishops & b.Position.WhiteBishops) > 0 {
-		res -= startPenalty * float64(len(SquaresFromBitBoard(wStartBishops&b.Position.WhiteBishops)))
+		res -= startPenalty * float64(bits.OnesCount64(wStartBishops&b.Position.WhiteBishops))
 
 	}
 	// Right now, avoid double penalizing knights with the PS Tables.
 	if wStartKnights&b.Position.WhiteKnights > 0 && false {
-		res -= startPenalty * float64(len(SquaresFromBitBoard(wStartKnights&b.Position.WhiteKnights)))
+		res -= startPenalty * float64(bits.OnesCount64(wStartKnights&b.Position.WhiteKnights))
 
 	}
 	if bStartBishops&b.Position.BlackBishops > 0 {
-		res += startPenalty * float64(len(SquaresFromBitBoard(bStartBishops&b.Position.BlackBishops)))
+		res += startPenalty * float64(bits.OnesCount64(bStartBishops&b.Position.BlackBishops))
 	}
 
 	// Right now, avoid double penalizing knights with the PS Tables.
 	if bStartKnights&b.Position.BlackKnights > 0 && false {
-		res += startPenalty * float64(len(SquaresFromBitBoard(bStartKnights&b.Position.BlackKnights)))
+		res += startPenalty * float64(bits.OnesCount64(bStartKnights&b.Position.BlackKnights))
 	}
-	return float64(b.Active) * res
+	return float64(b.Active) * res, 0
 }
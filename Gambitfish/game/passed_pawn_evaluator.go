@@ -0,0 +1,161 @@
+// passed_pawn_evaluator.go scores passed pawns, which grow stronger as they
+// advance and as the pieces that could stop them come off the board.
+package game
+
+// PASSED_PAWN_BONUS_MG and PASSED_PAWN_BONUS_EG are the bonuses for a
+// passed pawn in the middlegame and endgame, by its rank counted from its
+// own side, starting from the first.
+var PASSED_PAWN_BONUS_MG = [8]float64{0, .05, .1, .15, .25, .4, .6, 0}
+var PASSED_PAWN_BONUS_EG = [8]float64{0, .1, .15, .25, .45, .7, 1.1, 0}
+
+// A passed pawn with an enemy piece on the square in front of it only gets
+// this much of its bonus.
+const PASSED_PAWN_BLOCKADE_FACTOR = .5
+
+// The endgame bonus is multiplied by PASSED_PAWN_FREE_PATH_FACTOR if there
+// is nothing in the way of the pawn promoting, and again by
+// PASSED_PAWN_SAFE_PATH_FACTOR if no enemy piece attacks its path either.
+const PASSED_PAWN_FREE_PATH_FACTOR = 1.25
+const PASSED_PAWN_SAFE_PATH_FACTOR = 1.25
+
+// In the endgame, for each rank a passed pawn has advanced past the
+// second, every square between the enemy king and the square in front of
+// the pawn is worth PASSED_PAWN_ENEMY_KING_DISTANCE, and every square
+// between our king and it costs PASSED_PAWN_OWN_KING_DISTANCE.
+const PASSED_PAWN_ENEMY_KING_DISTANCE = .02
+const PASSED_PAWN_OWN_KING_DISTANCE = .01
+
+// UNSTOPPABLE_PASSER_BONUS is the endgame bonus for a passed pawn that
+// will promote before the enemy king can catch it, when the enemy has only
+// pawns left. It's most of a queen.
+const UNSTOPPABLE_PASSER_BONUS = 7.0
+
+type PassedPawnEvaluator struct {
+	// Pawns, if not nil, caches the passed pawns between positions with
+	// the same pawns and kings.
+	Pawns *PawnTable
+}
+
+func (e PassedPawnEvaluator) WithPawnTable(t *PawnTable) Evaluator {
+	e.Pawns = t
+	return e
+}
+
+func (e PassedPawnEvaluator) Evaluate(b *Board) float64 {
+	mg, eg := e.EvaluateTapered(b)
+	return Taper(mg, eg, GamePhase(b))
+}
+
+// EvaluateTapered scores passed pawns by their rank, whether they are
+// blockaded or have a free path, how close the kings are to them, and
+// whether they can be caught at all.
+func (e PassedPawnEvaluator) EvaluateTapered(b *Board) (mg, eg float64) {
+	var wp, bp uint64
+	if e.Pawns != nil {
+		entry := e.Pawns.Probe(b)
+		wp, bp = entry.WhitePassed, entry.BlackPassed
+	} else {
+		wp = passedPawns(b.Position.WhitePawns, b.Position.BlackPawns, WHITE)
+		bp = passedPawns(b.Position.BlackPawns, b.Position.WhitePawns, BLACK)
+	}
+	if wp|bp == 0 {
+		return 0, 0
+	}
+	wmg, weg := passedPawnScore(b, wp, WHITE)
+	bmg, beg := passedPawnScore(b, bp, BLACK)
+	mg, eg = wmg-bmg, weg-beg
+	if unstoppablePasser(b, wp, WHITE) {
+		eg += UNSTOPPABLE_PASSER_BONUS
+	}
+	if unstoppablePasser(b, bp, BLACK) {
+		eg -= UNSTOPPABLE_PASSER_BONUS
+	}
+	return float64(b.Active) * mg, float64(b.Active) * eg
+}
+
+// passedPawnScore scores the passed pawns of color c from c's point of
+// view.
+func passedPawnScore(b *Board, passed uint64, c Color) (mg, eg float64) {
+	if passed == 0 {
+		return 0, 0
+	}
+	pos := &b.Position
+	enemy, ownKing, enemyKing, forward := pos.BlackPieces, LSB(pos.WhiteKing), LSB(pos.BlackKing), 8
+	if c == BLACK {
+		enemy, ownKing, enemyKing, forward = pos.WhitePieces, LSB(pos.BlackKing), LSB(pos.WhiteKing), -8
+	}
+	for passed != 0 {
+		s := PopLSB(&passed)
+		rank := relativeRow(s, c)
+		stop := Square(int(s) + forward)
+		path := frontSpan(s, c) & fileMask(s)
+		pmg, peg := PASSED_PAWN_BONUS_MG[rank-1], PASSED_PAWN_BONUS_EG[rank-1]
+		if path&pos.Occupied == 0 {
+			peg *= PASSED_PAWN_FREE_PATH_FACTOR
+			if !anyAttacked(b, path, -1*c) {
+				peg *= PASSED_PAWN_SAFE_PATH_FACTOR
+			}
+		} else if enemy&SetBitOnBoard(0, stop) != 0 {
+			pmg *= PASSED_PAWN_BLOCKADE_FACTOR
+			peg *= PASSED_PAWN_BLOCKADE_FACTOR
+		}
+		w := float64(rank - 2)
+		peg += w * PASSED_PAWN_ENEMY_KING_DISTANCE * float64(Distance(enemyKing, stop))
+		peg -= w * PASSED_PAWN_OWN_KING_DISTANCE * float64(Distance(ownKing, stop))
+		mg += pmg
+		eg += peg
+	}
+	return mg, eg
+}
+
+// unstoppablePasser returns true if one of the passed pawns of color c
+// can't be caught by the enemy king, by the rule of the square, and the
+// enemy has no pieces but pawns to stop it with.
+func unstoppablePasser(b *Board, passed uint64, c Color) bool {
+	pos := &b.Position
+	enemyPieces, enemyKing, promotionRow := pos.BlackPieces&^(pos.BlackPawns|pos.BlackKing), LSB(pos.BlackKing), 8
+	if c == BLACK {
+		enemyPieces, enemyKing, promotionRow = pos.WhitePieces&^(pos.WhitePawns|pos.WhiteKing), LSB(pos.WhiteKing), 1
+	}
+	if enemyPieces != 0 {
+		return false
+	}
+	for passed != 0 {
+		s := PopLSB(&passed)
+		// Our own pieces in the way would slow the pawn down.
+		if frontSpan(s, c)&fileMask(s)&pos.Occupied != 0 {
+			continue
+		}
+		promotion := GetSquare(promotionRow, s.Col())
+		moves := Distance(s, promotion)
+		if relativeRow(s, c) == 2 {
+			moves-- // It can advance two squares at once.
+		}
+		kingMoves := Distance(enemyKing, promotion)
+		if b.Active != c {
+			kingMoves--
+		}
+		if kingMoves > moves {
+			return true
+		}
+	}
+	return false
+}
+
+// anyAttacked returns true if a piece of color c attacks one of squares.
+func anyAttacked(b *Board, squares uint64, c Color) bool {
+	for squares != 0 {
+		if AttackersTo(b, PopLSB(&squares), b.Position.Occupied, c) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// relativeRow returns the row of s counted from c's side of the board.
+func relativeRow(s Square, c Color) int {
+	if c == BLACK {
+		return 9 - s.Row()
+	}
+	return s.Row()
+}
@@ -0,0 +1,98 @@
+package game
+
+import "math"
+import "testing"
+
+func TestUnstoppablePasser(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		c    Color
+		want bool
+	}{
+		{"king too far away", "8/8/8/P7/8/8/7k/4K3 w - - 0 1", WHITE, true},
+		{"king in the square", "8/8/3k4/P7/8/8/8/4K3 w - - 0 1", WHITE, false},
+		{"king on the edge of the square to move", "8/8/8/P7/3k4/8/8/4K3 b - - 0 1", WHITE, false},
+		{"king on the edge of the square not to move", "8/8/8/P7/3k4/8/8/4K3 w - - 0 1", WHITE, true},
+		{"enemy rook", "7r/8/8/P7/8/8/7k/4K3 w - - 0 1", WHITE, false},
+		{"path blocked by our king", "K7/8/8/P7/8/8/7k/8 w - - 0 1", WHITE, false},
+		{"two squares from the start", "8/8/8/8/8/8/P7/4K2k w - - 0 1", WHITE, true},
+		{"black pawn", "4k3/8/8/8/8/p7/8/4K3 w - - 0 1", BLACK, true},
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		own, enemy := b.Position.WhitePawns, b.Position.BlackPawns
+		if tc.c == BLACK {
+			own, enemy = enemy, own
+		}
+		if got := unstoppablePasser(b, passedPawns(own, enemy, tc.c), tc.c); got != tc.want {
+			t.Errorf("%v: got unstoppable %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Test that the passed pawn terms prefer the positions they should. The
+// black knights keep the pawns from being unstoppable.
+func TestPassedPawnEvaluator(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name          string
+		better, worse string
+	}{
+		{
+			name:   "further advanced",
+			better: "4k3/8/P7/8/8/8/8/4K2n w - - 0 1",
+			worse:  "4k3/8/8/8/P7/8/8/4K2n w - - 0 1",
+		}, {
+			name:   "not blockaded",
+			better: "7k/8/8/3P4/8/8/8/n3K3 w - - 0 1",
+			worse:  "7k/8/3n4/3P4/8/8/8/4K3 w - - 0 1",
+		}, {
+			name:   "path not attacked",
+			better: "7k/8/8/3P4/8/8/8/n3K3 w - - 0 1",
+			worse:  "7k/8/8/1n1P4/8/8/8/4K3 w - - 0 1",
+		}, {
+			name:   "our king close",
+			better: "7k/8/8/4P3/4K3/8/8/n7 w - - 0 1",
+			worse:  "7k/8/8/4P3/8/8/8/K6n w - - 0 1",
+		}, {
+			name:   "their king far away",
+			better: "k7/8/8/4P3/8/8/8/4K2n w - - 0 1",
+			worse:  "8/4k3/8/4P3/8/8/8/4K2n w - - 0 1",
+		}, {
+			name:   "unstoppable",
+			better: "8/8/8/P7/8/8/7k/4K3 w - - 0 1",
+			worse:  "8/8/3k4/P7/8/8/8/4K3 w - - 0 1",
+		},
+	}
+	e := PassedPawnEvaluator{}
+	for _, tc := range testCases {
+		better, err := BoardFromFen(tc.better)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		worse, err := BoardFromFen(tc.worse)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		if got, other := e.Evaluate(better), e.Evaluate(worse); got <= other {
+			t.Errorf("%v: got %v, which isn't better than %v", tc.name, got, other)
+		}
+	}
+	// The same pawns with the colors swapped score the same.
+	b, err := BoardFromFen("4k3/8/3n4/3P3p/8/8/8/4K3 w - - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	mirror, err := BoardFromFen("4k3/8/8/8/3p3P/3N4/8/4K3 b - - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	if got, other := e.Evaluate(b), e.Evaluate(mirror); math.Abs(got-other) > 1e-9 {
+		t.Errorf("got %v, and %v with the colors swapped", got, other)
+	}
+}
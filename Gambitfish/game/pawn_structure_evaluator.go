@@ -0,0 +1,140 @@
+// pawn_structure_evaluator.go scores the shape of each side's pawns. Pawns
+// can't move back, so weaknesses in their structure are long-lasting, and
+// matter more the fewer pieces are left to make up for them.
+package game
+
+import "math/bits"
+
+// Pawn structure terms in pawns, for the middlegame and endgame. Each
+// applies once per pawn, except islands, which apply once per island after
+// the first.
+const DOUBLED_PAWN_PENALTY_MG = .1
+const DOUBLED_PAWN_PENALTY_EG = .2
+const ISOLATED_PAWN_PENALTY_MG = .15
+const ISOLATED_PAWN_PENALTY_EG = .2
+const BACKWARD_PAWN_PENALTY_MG = .1
+const BACKWARD_PAWN_PENALTY_EG = .1
+const CONNECTED_PAWN_BONUS_MG = .05
+const CONNECTED_PAWN_BONUS_EG = .05
+const PAWN_ISLAND_PENALTY_MG = .05
+const PAWN_ISLAND_PENALTY_EG = .1
+
+type PawnStructureEvaluator struct {
+	// Pawns, if not nil, caches the evaluation between positions with the
+	// same pawns and kings.
+	Pawns *PawnTable
+}
+
+func (e PawnStructureEvaluator) WithPawnTable(t *PawnTable) Evaluator {
+	e.Pawns = t
+	return e
+}
+
+func (e PawnStructureEvaluator) Evaluate(b *Board) float64 {
+	mg, eg := e.EvaluateTapered(b)
+	return Taper(mg, eg, GamePhase(b))
+}
+
+// EvaluateTapered scores doubled, isolated, backward and connected pawns
+// and pawn islands.
+func (e PawnStructureEvaluator) EvaluateTapered(b *Board) (mg, eg float64) {
+	if e.Pawns != nil {
+		entry := e.Pawns.Probe(b)
+		mg, eg = entry.StructureMG, entry.StructureEG
+	} else {
+		mg, eg = pawnStructure(b)
+	}
+	return float64(b.Active) * mg, float64(b.Active) * eg
+}
+
+// pawnStructure scores both sides' pawns from white's point of view.
+func pawnStructure(b *Board) (mg, eg float64) {
+	wp := b.Position.WhitePawns
+	bp := b.Position.BlackPawns
+	wmg, weg := pawnStructureScore(wp, bp, WHITE)
+	bmg, beg := pawnStructureScore(bp, wp, BLACK)
+	return wmg - bmg, weg - beg
+}
+
+// pawnStructureScore scores the pawns of color c, own, against the enemy
+// pawns, from c's point of view.
+func pawnStructureScore(own, enemy uint64, c Color) (mg, eg float64) {
+	doubled, isolated, backward, connected := pawnFeatures(own, enemy, c)
+	n := float64(bits.OnesCount64(doubled))
+	mg -= DOUBLED_PAWN_PENALTY_MG * n
+	eg -= DOUBLED_PAWN_PENALTY_EG * n
+	n = float64(bits.OnesCount64(isolated))
+	mg -= ISOLATED_PAWN_PENALTY_MG * n
+	eg -= ISOLATED_PAWN_PENALTY_EG * n
+	n = float64(bits.OnesCount64(backward))
+	mg -= BACKWARD_PAWN_PENALTY_MG * n
+	eg -= BACKWARD_PAWN_PENALTY_EG * n
+	n = float64(bits.OnesCount64(connected))
+	mg += CONNECTED_PAWN_BONUS_MG * n
+	eg += CONNECTED_PAWN_BONUS_EG * n
+	if islands := pawnIslands(own); islands > 1 {
+		mg -= PAWN_ISLAND_PENALTY_MG * float64(islands-1)
+		eg -= PAWN_ISLAND_PENALTY_EG * float64(islands-1)
+	}
+	return mg, eg
+}
+
+// pawnFeatures classifies the pawns of color c, own:
+// doubled pawns have another of our pawns in front of them on their file;
+// isolated pawns have none of our pawns on the files next to them;
+// backward pawns aren't isolated, but have all of those pawns in front of
+// them, and can't advance without being taken by an enemy pawn;
+// connected pawns are defended by one of our pawns, or have one beside
+// them.
+func pawnFeatures(own, enemy uint64, c Color) (doubled, isolated, backward, connected uint64) {
+	for bb := own; bb != 0; {
+		s := PopLSB(&bb)
+		sq := SetBitOnBoard(0, s)
+		neighbours := adjacentFiles(s) & own
+		if frontSpan(s, c)&fileMask(s)&own != 0 {
+			doubled |= sq
+		}
+		if neighbours == 0 {
+			isolated |= sq
+		} else if neighbours&^frontSpan(s, c) == 0 && stopAttacked(s, enemy, c) {
+			backward |= sq
+		}
+		if pawnDefenders(s, own, c) != 0 || neighbours&rankMask(s) != 0 {
+			connected |= sq
+		}
+	}
+	return doubled, isolated, backward, connected
+}
+
+// stopAttacked returns true if an enemy pawn attacks the square in front of
+// a pawn of color c on s.
+func stopAttacked(s Square, enemy uint64, c Color) bool {
+	if c == WHITE {
+		return WHITEPAWNATTACKS[s+8]&enemy != 0
+	}
+	return BLACKPAWNATTACKS[s-8]&enemy != 0
+}
+
+// pawnDefenders returns the pawns of color c, own, that defend square s.
+func pawnDefenders(s Square, own uint64, c Color) uint64 {
+	if c == WHITE {
+		return BLACKPAWNATTACKS[s] & own
+	}
+	return WHITEPAWNATTACKS[s] & own
+}
+
+// pawnIslands returns the number of groups of pawns on adjacent files.
+func pawnIslands(pawns uint64) int {
+	// Fold the ranks together to get one bit for each file with a pawn.
+	files := pawns | pawns>>32
+	files |= files >> 16
+	files |= files >> 8
+	files &= 0xFF
+	// Count the files that start a group.
+	return bits.OnesCount64(files &^ (files << 1))
+}
+
+// rankMask returns the squares on the rank of s.
+func rankMask(s Square) uint64 {
+	return uint64(0xFF) << uint(8*(s.Row()-1))
+}
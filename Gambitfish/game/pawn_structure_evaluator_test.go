@@ -0,0 +1,149 @@
+package game
+
+import "math"
+import "testing"
+
+func TestPawnFeatures(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name      string
+		fen       string
+		c         Color
+		doubled   []Square
+		isolated  []Square
+		backward  []Square
+		connected []Square
+	}{
+		{
+			name:      "starting board",
+			fen:       "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			c:         WHITE,
+			connected: []Square{A2, B2, C2, D2, E2, F2, G2, H2},
+		}, {
+			name:     "passed and isolated",
+			fen:      "4k3/p7/8/3P4/8/6p1/6P1/4K3 w - - 0 1",
+			c:        WHITE,
+			isolated: []Square{D5, G2},
+		}, {
+			name:     "doubled and isolated",
+			fen:      "4k3/8/8/8/8/2P5/2P5/4K3 w - - 0 1",
+			c:        WHITE,
+			doubled:  []Square{C2},
+			isolated: []Square{C2, C3},
+		}, {
+			name:      "backward pawn behind its neighbour",
+			fen:       "4k3/8/8/3p4/3P4/2P5/8/4K3 w - - 0 1",
+			c:         WHITE,
+			backward:  []Square{C3},
+			connected: []Square{D4},
+		}, {
+			name:     "isolated black pawn",
+			fen:      "4k3/8/8/3p4/3P4/2P5/8/4K3 w - - 0 1",
+			c:        BLACK,
+			isolated: []Square{D5},
+		}, {
+			name:      "pawn behind its neighbour with a free stop square",
+			fen:       "4k3/8/8/8/3P4/2P5/8/4K3 w - - 0 1",
+			c:         WHITE,
+			connected: []Square{D4},
+		}, {
+			name:      "black pawns side by side",
+			fen:       "4k3/8/3pp3/8/8/8/8/4K3 w - - 0 1",
+			c:         BLACK,
+			connected: []Square{D6, E6},
+		},
+	}
+	bitboard := func(squares []Square) uint64 {
+		var bb uint64
+		for _, s := range squares {
+			bb = SetBitOnBoard(bb, s)
+		}
+		return bb
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		own, enemy := b.Position.WhitePawns, b.Position.BlackPawns
+		if tc.c == BLACK {
+			own, enemy = enemy, own
+		}
+		doubled, isolated, backward, connected := pawnFeatures(own, enemy, tc.c)
+		if want := bitboard(tc.doubled); doubled != want {
+			t.Errorf("%v: got doubled pawns %v, want %v", tc.name, SquaresFromBitBoard(doubled), tc.doubled)
+		}
+		if want := bitboard(tc.isolated); isolated != want {
+			t.Errorf("%v: got isolated pawns %v, want %v", tc.name, SquaresFromBitBoard(isolated), tc.isolated)
+		}
+		if want := bitboard(tc.backward); backward != want {
+			t.Errorf("%v: got backward pawns %v, want %v", tc.name, SquaresFromBitBoard(backward), tc.backward)
+		}
+		if want := bitboard(tc.connected); connected != want {
+			t.Errorf("%v: got connected pawns %v, want %v", tc.name, SquaresFromBitBoard(connected), tc.connected)
+		}
+	}
+}
+
+func TestPawnIslands(t *testing.T) {
+	testCases := []struct {
+		pawns []Square
+		want  int
+	}{
+		{nil, 0},
+		{[]Square{A2, B2, C2, D2, E2, F2, G2, H2}, 1},
+		{[]Square{A2, C2, D3, H2}, 3},
+		{[]Square{A2, A3, H7}, 2},
+	}
+	for _, tc := range testCases {
+		var bb uint64
+		for _, s := range tc.pawns {
+			bb = SetBitOnBoard(bb, s)
+		}
+		if got := pawnIslands(bb); got != tc.want {
+			t.Errorf("%v: got %v islands, want %v", tc.pawns, got, tc.want)
+		}
+	}
+}
+
+// Test that the pawn structure is scored the same for either color, and
+// that better structures score higher.
+func TestPawnStructureEvaluator(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		// mirror is the same position with the colors swapped.
+		mirror string
+		better bool // Whether white's pawns are better.
+	}{
+		{
+			name:   "isolated queen's pawn",
+			fen:    "4k3/pp3ppp/4p3/8/3P4/8/PP3PPP/4K3 w - - 0 1",
+			mirror: "4k3/pp3ppp/8/3p4/8/4P3/PP3PPP/4K3 b - - 0 1",
+		}, {
+			name:   "healthy against doubled",
+			fen:    "4k3/p1p2ppp/2p5/8/8/8/PPP2PPP/4K3 w - - 0 1",
+			mirror: "4k3/ppp2ppp/8/8/8/2P5/P1P2PPP/4K3 b - - 0 1",
+			better: true,
+		},
+	}
+	e := PawnStructureEvaluator{}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		mirror, err := BoardFromFen(tc.mirror)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		got := e.Evaluate(b)
+		if other := e.Evaluate(mirror); math.Abs(got-other) > 1e-9 {
+			t.Errorf("%v: got %v, and %v with the colors swapped", tc.name, got, other)
+		}
+		if (got > 0) != tc.better {
+			t.Errorf("%v: got %v, want white's pawns better %v", tc.name, got, tc.better)
+		}
+	}
+}
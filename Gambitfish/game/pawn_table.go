@@ -0,0 +1,123 @@
+// pawn_table.go caches evaluation terms that only depend on where the pawns
+// and kings are. Pawn structures change rarely during a search, so almost
+// every lookup is a hit.
+package game
+
+import "fmt"
+
+// DEFAULT_PAWN_HASH_MB is the size of a pawn table in megabytes unless
+// asked otherwise.
+const DEFAULT_PAWN_HASH_MB = 2
+
+// PawnEntry holds the pawn structure of a position. Scores are from
+// white's point of view.
+type PawnEntry struct {
+	Key uint64
+	// Pawns with no enemy pawns in front of them on their own or adjacent
+	// files. The rear pawn of a doubled pair doesn't count.
+	WhitePassed uint64
+	BlackPassed uint64
+	// KingSafety is the pawn shield and placement of the kings.
+	KingSafety float64
+	// The middlegame and endgame scores of the pawn structure.
+	StructureMG float64
+	StructureEG float64
+}
+
+// PawnTable is a cache of pawn structures, indexed by a board's PawnHash.
+// It isn't safe for concurrent use, so each search needs its own.
+type PawnTable struct {
+	entries []PawnEntry
+	mask    uint64
+	// Lookup statistics.
+	Probes int
+	Hits   int
+}
+
+// NewPawnTable returns a pawn table using at most mb megabytes of memory.
+func NewPawnTable(mb int) *PawnTable {
+	if mb < 1 {
+		mb = 1
+	}
+	n := uint64(mb) * 1024 * 1024 / 48
+	size := uint64(1)
+	for size*2 <= n {
+		size *= 2
+	}
+	return &PawnTable{entries: make([]PawnEntry, size), mask: size - 1}
+}
+
+// Probe returns the pawn structure of b, computing and storing it if the
+// table doesn't have it yet. The entry is only valid until the next probe.
+func (t *PawnTable) Probe(b *Board) *PawnEntry {
+	t.Probes++
+	e := &t.entries[b.PawnHash&t.mask]
+	if e.Key == b.PawnHash {
+		t.Hits++
+		return e
+	}
+	*e = NewPawnEntry(b)
+	return e
+}
+
+// HitRate is the fraction of probes that found their entry in the table.
+func (t *PawnTable) HitRate() float64 {
+	if t.Probes == 0 {
+		return 0
+	}
+	return float64(t.Hits) / float64(t.Probes)
+}
+
+func (t *PawnTable) String() string {
+	return fmt.Sprintf("probes %v hits %v (%.1f%%)", t.Probes, t.Hits, 100*t.HitRate())
+}
+
+// NewPawnEntry computes the pawn structure of b from scratch.
+func NewPawnEntry(b *Board) PawnEntry {
+	wp := b.Position.WhitePawns
+	bp := b.Position.BlackPawns
+	e := PawnEntry{Key: b.PawnHash, KingSafety: kingSafety(b)}
+	e.StructureMG, e.StructureEG = pawnStructure(b)
+	e.WhitePassed = passedPawns(wp, bp, WHITE)
+	e.BlackPassed = passedPawns(bp, wp, BLACK)
+	return e
+}
+
+// passedPawns returns the pawns of color c, own, with no enemy pawns in
+// front of them on their own or adjacent files, except for the rear pawn
+// of a doubled pair.
+func passedPawns(own, enemy uint64, c Color) uint64 {
+	var passed uint64
+	for bb := own; bb != 0; {
+		s := PopLSB(&bb)
+		if frontSpan(s, c)&passedMask(s)&enemy == 0 && frontSpan(s, c)&fileMask(s)&own == 0 {
+			passed |= SetBitOnBoard(0, s)
+		}
+	}
+	return passed
+}
+
+// fileMask returns the squares on the file of s.
+func fileMask(s Square) uint64 {
+	return uint64(0x0101010101010101) << uint(s.Col()-1)
+}
+
+// adjacentFiles returns the squares on the files next to s.
+func adjacentFiles(s Square) uint64 {
+	f := fileMask(s)
+	return (f<<1)&^uint64(0x0101010101010101) | (f>>1)&^uint64(0x8080808080808080)
+}
+
+// passedMask returns the squares on the file of s and the files next to it.
+func passedMask(s Square) uint64 {
+	return fileMask(s) | adjacentFiles(s)
+}
+
+// frontSpan returns every square on a rank ahead of s, from c's point of view.
+func frontSpan(s Square, c Color) uint64 {
+	row := uint(s.Row())
+	if c == WHITE {
+		return ^uint64(0) << (8 * row)
+	}
+	return ^uint64(0) >> (8 * (9 - row))
+}
@@ -0,0 +1,100 @@
+package game
+
+import "testing"
+
+func TestPawnEntry(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name        string
+		fen         string
+		whitePassed []Square
+		blackPassed []Square
+	}{
+		{
+			name: "starting board",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		}, {
+			name:        "passed and isolated",
+			fen:         "4k3/p7/8/3P4/8/6p1/6P1/4K3 w - - 0 1",
+			whitePassed: []Square{D5},
+			blackPassed: []Square{A7},
+		}, {
+			name:        "doubled",
+			fen:         "4k3/8/8/8/8/2P5/1PP5/4K3 w - - 0 1",
+			whitePassed: []Square{B2, C3},
+		},
+	}
+	squares := func(s []Square) uint64 {
+		var bb uint64
+		for _, sq := range s {
+			bb = SetBitOnBoard(bb, sq)
+		}
+		return bb
+	}
+	for _, tc := range testCases {
+		b, err := BoardFromFen(tc.fen)
+		if err != nil {
+			t.Fatalf("%v: error reading fen: %v", tc.name, err)
+		}
+		e := NewPawnEntry(b)
+		if want := squares(tc.whitePassed); e.WhitePassed != want {
+			t.Errorf("%v: got white passed pawns %v, want %v", tc.name, SquaresFromBitBoard(e.WhitePassed), tc.whitePassed)
+		}
+		if want := squares(tc.blackPassed); e.BlackPassed != want {
+			t.Errorf("%v: got black passed pawns %v, want %v", tc.name, SquaresFromBitBoard(e.BlackPassed), tc.blackPassed)
+		}
+		if mg, eg := pawnStructure(b); e.StructureMG != mg || e.StructureEG != eg {
+			t.Errorf("%v: got pawn structure %v, %v, want %v, %v", tc.name, e.StructureMG, e.StructureEG, mg, eg)
+		}
+	}
+}
+
+func TestPawnTable(t *testing.T) {
+	InitInternalData()
+	b, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	pawns := NewPawnTable(1)
+	cached := KingSafetyEvaluator{Pawns: pawns}
+	uncached := KingSafetyEvaluator{}
+	cachedStructure := PawnStructureEvaluator{Pawns: pawns}
+	for _, m := range b.AllLegalMoves() {
+		bs := ApplyMove(b, m)
+		b.SwitchActivePlayer()
+		if got, want := cached.Evaluate(b), uncached.Evaluate(b); got != want {
+			t.Errorf("after %v: got cached king safety %v, want %v", m, got, want)
+		}
+		if got, want := cachedStructure.Evaluate(b), (PawnStructureEvaluator{}).Evaluate(b); got != want {
+			t.Errorf("after %v: got cached pawn structure %v, want %v", m, got, want)
+		}
+		UndoMove(b, m, bs)
+		b.SwitchActivePlayer()
+	}
+	// Most moves don't touch a pawn or king, so their positions share the
+	// pawn structure we started with.
+	if pawns.Hits == 0 || pawns.Hits >= pawns.Probes {
+		t.Errorf("got %v hits from %v probes", pawns.Hits, pawns.Probes)
+	}
+}
+
+// Test that king safety is scored for the side to move, like every other
+// evaluation, with or without a pawn table.
+func TestKingSafetySideToMove(t *testing.T) {
+	InitInternalData()
+	// White has castled behind its pawns, black's king is still in the
+	// middle.
+	b, err := BoardFromFen("rnbqk2r/pppp1ppp/5n2/2b1p3/2B1P3/5N2/PPPP1PPP/RNBQ1RK1 w kq - 0 1")
+	if err != nil {
+		t.Fatalf("error reading fen: %v", err)
+	}
+	for _, e := range []KingSafetyEvaluator{{}, {Pawns: NewPawnTable(1)}} {
+		white := e.Evaluate(b)
+		b.SwitchActivePlayer()
+		black := e.Evaluate(b)
+		b.SwitchActivePlayer()
+		if white <= 0 || black != -white {
+			t.Errorf("got %v with white to move and %v with black to move, want a positive score and its negation", white, black)
+		}
+	}
+}
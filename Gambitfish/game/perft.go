@@ -0,0 +1,139 @@
+// perft.go counts the positions reachable from a board, to check the move
+// generator against known results and to measure its speed.
+// See https://www.chessprogramming.org/Perft
+package game
+
+import "sync"
+import "sync/atomic"
+
+// Perft returns the number of move sequences depth plies long from b. The
+// board is left as it was found.
+func Perft(b *Board, depth int) uint64 {
+	return perft(b, depth, nil)
+}
+
+// PerftTable caches perft counts of positions reached by transposition.
+// It's safe to share between goroutines.
+type PerftTable struct {
+	slots []perftSlot
+	mask  uint64
+}
+
+// perftSlot holds a count and its key, xored together the same way as a
+// ttSlot so that a torn write looks like a miss instead of a wrong count.
+type perftSlot struct {
+	check uint64 // key ^ count
+	count uint64
+}
+
+// NewPerftTable returns a table using at most mb megabytes of memory.
+func NewPerftTable(mb int) *PerftTable {
+	if mb < 1 {
+		mb = 1
+	}
+	n := uint64(mb) * 1024 * 1024 / 16
+	size := uint64(1)
+	for size*2 <= n {
+		size *= 2
+	}
+	return &PerftTable{slots: make([]perftSlot, size), mask: size - 1}
+}
+
+// perftKey mixes the depth into the hash, since a position has a
+// different count at every depth.
+func perftKey(hash uint64, depth int) uint64 {
+	return hash ^ uint64(depth)*0x9E3779B97F4A7C15
+}
+
+func (t *PerftTable) probe(hash uint64, depth int) (uint64, bool) {
+	key := perftKey(hash, depth)
+	s := &t.slots[key&t.mask]
+	count := atomic.LoadUint64(&s.count)
+	if count == 0 || atomic.LoadUint64(&s.check)^count != key {
+		return 0, false
+	}
+	return count, true
+}
+
+func (t *PerftTable) store(hash uint64, depth int, count uint64) {
+	key := perftKey(hash, depth)
+	s := &t.slots[key&t.mask]
+	atomic.StoreUint64(&s.count, count)
+	atomic.StoreUint64(&s.check, key^count)
+}
+
+func perft(b *Board, depth int, t *PerftTable) uint64 {
+	if depth <= 0 {
+		return 1
+	}
+	if t != nil && depth > 1 {
+		if count, ok := t.probe(b.Hash, depth); ok {
+			return count
+		}
+	}
+	l := newLegality(b)
+	var buf [MAX_MOVES]EfficientMove
+	moves := b.generateLegalMoves(&l, buf[:0], ALLSQUARES, ALLSQUARES, ALLSQUARES)
+	// Counting the moves is as good as making them.
+	if depth == 1 {
+		return uint64(len(moves))
+	}
+	var count uint64
+	for _, m := range moves {
+		bs := ApplyMove(b, m)
+		b.SwitchActivePlayer()
+		count += perft(b, depth-1, t)
+		UndoMove(b, m, bs)
+		b.SwitchActivePlayer()
+	}
+	if t != nil {
+		t.store(b.Hash, depth, count)
+	}
+	return count
+}
+
+// PerftMove is the perft count below one of the root moves.
+type PerftMove struct {
+	Move  EfficientMove
+	Count uint64
+}
+
+// PerftDivide returns the perft count below each legal move of b, which
+// is the way to narrow a wrong count down to the move generation bug
+// behind it. t may be nil to search without a table. The root moves are
+// shared between threads goroutines, each with its own copy of the board.
+// There are no moves to divide by below depth 1.
+func PerftDivide(b *Board, depth int, t *PerftTable, threads int) []PerftMove {
+	if depth < 1 {
+		return nil
+	}
+	moves := b.AllLegalMoves()
+	res := make([]PerftMove, len(moves))
+	if threads < 1 {
+		threads = 1
+	}
+	next := int32(-1)
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := b.Clone()
+			for {
+				j := int(atomic.AddInt32(&next, 1))
+				if j >= len(moves) {
+					return
+				}
+				m := moves[j]
+				res[j].Move = m
+				bs := ApplyMove(c, m)
+				c.SwitchActivePlayer()
+				res[j].Count = perft(c, depth-1, t)
+				UndoMove(c, m, bs)
+				c.SwitchActivePlayer()
+			}
+		}()
+	}
+	wg.Wait()
+	return res
+}
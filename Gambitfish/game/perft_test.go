@@ -44,7 +44,7 @@ func TestPerft(t *testing.T) {
 		for i, want := range tc.moves {
 			depth := i + 1
 			start := time.Now()
-			got := PerftHelper(b, depth)
+			got := int(Perft(b, depth))
 			total := time.Since(start)
 			if got != want {
 				t.Errorf("%v got wrong result for depth %v: got %v, want %v", tc.name, depth, got, want)
@@ -55,19 +55,46 @@ func TestPerft(t *testing.T) {
 	}
 }
 
-// PerftHelper handles the move generation.
-func PerftHelper(b *Board, depth int) int {
-	legalMoves := b.AllLegalMoves()
-	if depth == 1 {
-		return len(legalMoves)
+// Test that dividing the count among the root moves adds up, with and
+// without a table and goroutines.
+func TestPerftDivide(t *testing.T) {
+	InitInternalData()
+	b, err := BoardFromFen("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 0")
+	if err != nil {
+		t.Fatalf("error reading fen string: %v", err)
+	}
+	want := uint64(97862)
+	testCases := []struct {
+		name    string
+		table   *PerftTable
+		threads int
+	}{
+		{name: "plain", threads: 1},
+		{name: "hashed", table: NewPerftTable(1), threads: 1},
+		{name: "threaded", threads: 4},
+		{name: "hashed and threaded", table: NewPerftTable(1), threads: 4},
 	}
-	result := 0
-	for _, move := range legalMoves {
-		bs := ApplyMove(b, move)
-		b.SwitchActivePlayer()
-		result += PerftHelper(b, depth-1)
-		UndoMove(b, move, bs)
-		b.SwitchActivePlayer()
+	for _, tc := range testCases {
+		res := PerftDivide(b, 3, tc.table, tc.threads)
+		if len(res) != 48 {
+			t.Errorf("%v: got %v root moves, want 48", tc.name, len(res))
+		}
+		var got uint64
+		for _, r := range res {
+			got += r.Count
+		}
+		if got != want {
+			t.Errorf("%v: got %v nodes, want %v", tc.name, got, want)
+		}
+	}
+	if res := PerftDivide(b, 0, nil, 1); len(res) != 0 {
+		t.Errorf("depth 0: got %v root moves, want none", len(res))
+	}
+	// A warm table has to give the same answer.
+	table := NewPerftTable(1)
+	for i := 0; i < 2; i++ {
+		if got := perft(b, 3, table); got != want {
+			t.Errorf("hashed perft pass %v: got %v nodes, want %v", i, got, want)
+		}
 	}
-	return result
 }
@@ -0,0 +1,31 @@
+// phase.go works out how far a game has gone from the middlegame to the
+// endgame, so that evaluation terms can fade in and out as pieces come off
+// the board instead of switching on or off at some arbitrary point.
+package game
+
+import "math/bits"
+
+// MAX_PHASE is the phase with all the pieces still on the board. Knights
+// and bishops count for 1, rooks 2 and queens 4; pawns and kings don't
+// count.
+const MAX_PHASE = 24
+
+// GamePhase returns how much material is left, from MAX_PHASE in the
+// middlegame down to 0 when only kings and pawns are left. Promoted
+// pieces can't take it above MAX_PHASE.
+func GamePhase(b *Board) int {
+	pos := &b.Position
+	phase := bits.OnesCount64(pos.WhiteKnights|pos.BlackKnights) +
+		bits.OnesCount64(pos.WhiteBishops|pos.BlackBishops) +
+		2*bits.OnesCount64(pos.WhiteRooks|pos.BlackRooks) +
+		4*bits.OnesCount64(pos.WhiteQueens|pos.BlackQueens)
+	if phase > MAX_PHASE {
+		phase = MAX_PHASE
+	}
+	return phase
+}
+
+// Taper blends a middlegame and an endgame score in proportion to phase.
+func Taper(mg, eg float64, phase int) float64 {
+	return (mg*float64(phase) + eg*float64(MAX_PHASE-phase)) / MAX_PHASE
+}
@@ -74,9 +74,8 @@ func LegalKnightMoves(b *Board, p Piece, cur Square) []EfficientMove {
 	pos := b.Position
 	km := LEGALKNIGHTMOVES[cur]
 	// Iterate through legal non captures
-	sq := SquaresFromBitBoard(km &^ pos.Occupied)
-	for i := 0; i < len(sq); i++ {
-		moves = append(moves, NewEfficientMove(p, sq[i], cur))
+	for bb := km &^ pos.Occupied; bb != 0; {
+		moves = append(moves, NewEfficientMove(p, PopLSB(&bb), cur))
 	}
 	// Iterate through legal captures
 	var opp uint64
@@ -86,9 +85,8 @@ func LegalKnightMoves(b *Board, p Piece, cur Square) []EfficientMove {
 	case BLACK:
 		opp = pos.WhitePieces
 	}
-	sq = SquaresFromBitBoard(km & opp)
-	for i := 0; i < len(sq); i++ {
-		s := sq[i]
+	for bb := km & opp; bb != 0; {
+		s := PopLSB(&bb)
 		move := NewEfficientMove(p, s, cur)
 		move = move.AddCapture(b.Squares[s])
 		if b.Squares[s] == NULLPIECE {
@@ -110,22 +108,17 @@ func RayMoves(b *Board, p Piece, cur Square, bishop, rook bool) []EfficientMove
 	var allAtk uint64
 	allAtk = 0
 	if bishop {
-		bm := BLOCKERMASKBISHOP[cur]
-		magic := MAGICNUMBERBISHOP[cur]
-		key := ((bm & pos.Occupied) * magic) >> SHIFTSIZEBISHOP[cur]
-		allAtk |= BISHOPATTACKS[cur][key]
+		allAtk |= BishopAttacks(cur, pos.Occupied)
 	}
 	if rook {
-		bm := BLOCKERMASKROOK[cur]
-		magic := MAGICNUMBERROOK[cur]
-		key := ((bm & pos.Occupied) * magic) >> SHIFTSIZEROOK[cur]
-		allAtk |= ROOKATTACKS[cur][key]
+		allAtk |= RookAttacks(cur, pos.Occupied)
 	}
 
 	// TODO(slisenberger)
 	// THIS IS ALL COPIED BOILERPLATE.. FACTOR THIS OUT.
 	// Iterate through legal non captures
-	for _, s := range SquaresFromBitBoard(allAtk &^ pos.Occupied) {
+	for bb := allAtk &^ pos.Occupied; bb != 0; {
+		s := PopLSB(&bb)
 		moves = append(moves, NewEfficientMove(p, s, cur))
 	}
 	// Iterate through legal captures
@@ -136,7 +129,8 @@ func RayMoves(b *Board, p Piece, cur Square, bishop, rook bool) []EfficientMove
 	case BLACK:
 		opp = pos.WhitePieces
 	}
-	for _, s := range SquaresFromBitBoard(allAtk & opp) {
+	for bb := allAtk & opp; bb != 0; {
+		s := PopLSB(&bb)
 		move := NewEfficientMove(p, s, cur)
 		move = move.AddCapture(b.Squares[s])
 		if b.Squares[s] == NULLPIECE {
@@ -162,19 +156,11 @@ func RayMoves(b *Board, p Piece, cur Square, bishop, rook bool) []EfficientMove
 
 func RayAttackBitboard(b *Board, cur Square, bishop, rook bool) uint64 {
 	var res uint64
-	res = 0
-	pos := b.Position
 	if bishop {
-		mask := BLOCKERMASKBISHOP[cur]
-		magic := MAGICNUMBERBISHOP[cur]
-		key := ((mask & pos.Occupied) * magic) >> SHIFTSIZEBISHOP[cur]
-		res |= BISHOPATTACKS[cur][key]
+		res |= BishopAttacks(cur, b.Position.Occupied)
 	}
 	if rook {
-		mask := BLOCKERMASKROOK[cur]
-		magic := MAGICNUMBERROOK[cur]
-		key := ((mask & pos.Occupied) * magic) >> SHIFTSIZEROOK[cur]
-		res |= ROOKATTACKS[cur][key]
+		res |= RookAttacks(cur, b.Position.Occupied)
 	}
 	return res
 }
@@ -184,7 +170,8 @@ func LegalKingMoves(b *Board, p Piece, cur Square) []EfficientMove {
 	pos := b.Position
 	km := LEGALKINGMOVES[cur]
 	// Iterate through legal non captures
-	for _, s := range SquaresFromBitBoard(km &^ pos.Occupied) {
+	for bb := km &^ pos.Occupied; bb != 0; {
+		s := PopLSB(&bb)
 		moves = append(moves, NewEfficientMove(p, s, cur))
 	}
 	// Iterate through legal captures
@@ -195,7 +182,8 @@ func LegalKingMoves(b *Board, p Piece, cur Square) []EfficientMove {
 	case BLACK:
 		opp = pos.WhitePieces
 	}
-	for _, s := range SquaresFromBitBoard(km & opp) {
+	for bb := km & opp; bb != 0; {
+		s := PopLSB(&bb)
 		move := NewEfficientMove(p, s, cur)
 		move = move.AddCapture(b.Squares[s])
 		if b.Squares[s] == NULLPIECE {
@@ -497,9 +485,8 @@ func LegalCaptures(b *Board, p Piece, cur Square) []EfficientMove {
 		opp = b.Position.WhitePieces
 	}
 
-	sq := SquaresFromBitBoard(atk & opp)
-	for i := 0; i < len(sq); i++ {
-		s := sq[i]
+	for bb := atk & opp; bb != 0; {
+		s := PopLSB(&bb)
 		isPromotion := p.Type() == PAWN && (s.Row() == 1 || s.Row() == 8)
 		if !isPromotion {
 			move := NewEfficientMove(p, s, cur)
@@ -547,9 +534,8 @@ func LegalCaptures(b *Board, p Piece, cur Square) []EfficientMove {
 	// Do En Passant captures for pawns.
 	if p.Type() == PAWN {
 		// If attacking the en passant square, we can capture there.
-		sq = SquaresFromBitBoard(atk)
-		for i := 0; i < len(sq); i++ {
-			s := sq[i]
+		for bb := atk; bb != 0; {
+			s := PopLSB(&bb)
 			if s == b.EPSquare {
 				var move EfficientMove
 				switch p.Color() {
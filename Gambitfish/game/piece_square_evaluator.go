@@ -74,47 +74,82 @@ var KING_VALUE_TABLE = [64]float64{
 	.04, .54, .47, -.99, -.99, .6, .83, -.62,
 }
 
+// Endgame tables. The tables above are for the middlegame, and the other
+// pieces use them in the endgame too.
+
+// In the endgame pawns are worth more the closer they get to promoting.
+var PAWN_ENDGAME_VALUE_TABLE = [64]float64{
+	0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0,
+	0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0,
+	.05, .05, .05, .05, .05, .05, .05, .05,
+	.15, .15, .15, .15, .15, .15, .15, .15,
+	.3, .3, .3, .3, .3, .3, .3, .3,
+	.5, .5, .5, .5, .5, .5, .5, .5,
+	.8, .8, .8, .8, .8, .8, .8, .8,
+	0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0,
+}
+
+// In the endgame the king belongs in the center, where it can support its
+// pawns and stop the opponent's. Neither side's half of the board is
+// better than the other's, so the table reads the same from either side.
+var KING_ENDGAME_VALUE_TABLE = [64]float64{
+	-.5, -.4, -.3, -.3, -.3, -.3, -.4, -.5,
+	-.3, -.2, -.1, 0.0, 0.0, -.1, -.2, -.3,
+	-.3, -.1, .2, .3, .3, .2, -.1, -.3,
+	-.3, -.1, .3, .4, .4, .3, -.1, -.3,
+	-.3, -.1, .3, .4, .4, .3, -.1, -.3,
+	-.3, -.1, .2, .3, .3, .2, -.1, -.3,
+	-.3, -.2, -.1, 0.0, 0.0, -.1, -.2, -.3,
+	-.5, -.4, -.3, -.3, -.3, -.3, -.4, -.5,
+}
+
 // Evaluates a board based on where pieces are located, as referenced
 // in the piece value tables.
 func (m PieceSquareEvaluator) Evaluate(b *Board) float64 {
-	eval := 0.0
-	for i, p := range b.Squares {
-		if p == NULLPIECE {
-			continue
-		}
-		sq := Square(i)
-		if p.Color() == BLACK {
-			sq = GetSquare(9-sq.Row(), sq.Col())
-		}
+	mg, eg := m.EvaluateTapered(b)
+	return Taper(mg, eg, GamePhase(b))
+}
+
+// EvaluateTapered looks pieces up in the middlegame and endgame tables.
+func (m PieceSquareEvaluator) EvaluateTapered(b *Board) (mg, eg float64) {
+	for occ := b.Position.Occupied; occ != 0; {
+		s := PopLSB(&occ)
+		p := b.Squares[s]
+		pmg, peg := pieceSquareValues(p, s)
+		mg += float64(p.Color()) * pmg
+		eg += float64(p.Color()) * peg
+	}
+	return float64(b.Active) * mg, float64(b.Active) * eg
+}
 
-		// We need to change our index for black since their board
-		// is mirrored.
-		switch p {
-		case WHITEPAWN:
-				eval += PAWN_VALUE_TABLE[sq]
-		case BLACKPAWN:
-				eval -= PAWN_VALUE_TABLE[sq]
-		case WHITEKNIGHT:
-				eval += KNIGHT_VALUE_TABLE[sq]
-		case BLACKKNIGHT:
-				eval -= KNIGHT_VALUE_TABLE[sq]
-		case WHITEROOK:
-				eval += ROOK_VALUE_TABLE[sq]
-		case BLACKROOK:
-				eval -= ROOK_VALUE_TABLE[sq]
-		case WHITEBISHOP:
-				eval += BISHOP_VALUE_TABLE[sq]
-		case BLACKBISHOP:
-				eval -= BISHOP_VALUE_TABLE[sq]
-		case WHITEQUEEN:
-				eval += QUEEN_VALUE_TABLE[sq]
-		case BLACKQUEEN:
-				eval -= QUEEN_VALUE_TABLE[sq]
-		case WHITEKING:
-				eval += KING_VALUE_TABLE[sq]
-		case BLACKKING:
-				eval -= KING_VALUE_TABLE[sq]
-		}
+// pieceSquareValue returns the middlegame table value of p standing on s,
+// from the point of view of p's side.
+func pieceSquareValue(p Piece, s Square) float64 {
+	mg, _ := pieceSquareValues(p, s)
+	return mg
+}
+
+// pieceSquareValues returns the middlegame and endgame table values of p
+// standing on s, from the point of view of p's side.
+func pieceSquareValues(p Piece, s Square) (mg, eg float64) {
+	// We need to change our index for black since their board
+	// is mirrored.
+	if p.Color() == BLACK {
+		s = GetSquare(9-s.Row(), s.Col())
+	}
+	switch p.Type() {
+	case PAWN:
+		return PAWN_VALUE_TABLE[s], PAWN_ENDGAME_VALUE_TABLE[s]
+	case KNIGHT:
+		return KNIGHT_VALUE_TABLE[s], KNIGHT_VALUE_TABLE[s]
+	case BISHOP:
+		return BISHOP_VALUE_TABLE[s], BISHOP_VALUE_TABLE[s]
+	case ROOK:
+		return ROOK_VALUE_TABLE[s], ROOK_VALUE_TABLE[s]
+	case QUEEN:
+		return QUEEN_VALUE_TABLE[s], QUEEN_VALUE_TABLE[s]
+	case KING:
+		return KING_VALUE_TABLE[s], KING_ENDGAME_VALUE_TABLE[s]
 	}
-	return float64(b.Active) * eval
+	return 0, 0
 }
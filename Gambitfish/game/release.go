@@ -0,0 +1,6 @@
+//go:build !debug
+
+package game
+
+// debug is off unless we build with -tags debug. See debug.go.
+const debug = false
@@ -1,6 +1,7 @@
 // Square is a convenience type for representing squares on the board.
 package game
 
+import "fmt"
 
 // Creates a type for the 64 legal square values.
 type Square uint
@@ -102,6 +103,32 @@ func (s Square) Col() int {
 	return int(s)%8 + 1
 }
 
+// Distance returns the number of king moves it takes to get from a to b.
+func Distance(a, b Square) int {
+	rows := a.Row() - b.Row()
+	if rows < 0 {
+		rows = -rows
+	}
+	cols := a.Col() - b.Col()
+	if cols < 0 {
+		cols = -cols
+	}
+	if rows > cols {
+		return rows
+	}
+	return cols
+}
+
+// ParseSquare returns the square with the given name, such as e4.
+func ParseSquare(name string) (Square, error) {
+	for s, n := range squareStrings {
+		if n == name {
+			return Square(s), nil
+		}
+	}
+	return OFFBOARD_SQUARE, fmt.Errorf("invalid square: %v", name)
+}
+
 // Prints this square as a string.
 func (s Square) String() string {
 	if s == OFFBOARD_SQUARE {
@@ -54,3 +54,21 @@ func TestIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestDistance(t *testing.T) {
+	testCases := []struct {
+		a, b Square
+		want int
+	}{
+		{A1, A1, 0},
+		{A1, H8, 7},
+		{E4, D5, 1},
+		{B2, B7, 5},
+		{G1, C2, 4},
+	}
+	for _, tc := range testCases {
+		if got := Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("distance from %v to %v: got %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
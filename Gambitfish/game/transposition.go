@@ -1,11 +1,10 @@
 // Transposition manages transposition tables for avoiding redoing calculation.
 package game
 
-type EvalPrecision int
+import "math"
+import "sync/atomic"
 
-// The transposition table holding a list of previously seen positions and
-// their evaluation.
-var TranspositionTable = map[uint64]TTEntry{}
+type EvalPrecision int
 
 const (
 	EvalExact = EvalPrecision(iota)
@@ -13,22 +12,239 @@ const (
 	EvalUpperBound
 )
 
+// DEFAULT_HASH_MB is the size of the transposition table in megabytes
+// unless the Hash option says otherwise.
+const DEFAULT_HASH_MB = 64
+
+// MAX_HASH_MB is the largest transposition table we build.
+const MAX_HASH_MB = 4096
+
+// TT_BUCKET_SIZE is the number of entries sharing a hash index. A new
+// entry replaces the least valuable one in its bucket.
+const TT_BUCKET_SIZE = 4
+
+// TT_MAX_SCORE is the largest evaluation (in centipawns) an entry can
+// hold. Larger scores, like a checkmate's infinity, are stored as
+// TT_INFINITE_SCORE.
+const TT_MAX_SCORE = 32000
+const TT_INFINITE_SCORE = math.MaxInt16
+
+// TTEntry is what a search learned about a position.
 type TTEntry struct {
 	Depth     int           // the depth this entry was searched to
-	Eval      float64       // What this was evaluated as.
+	Eval      float64       // What this was evaluated as, to the nearest centipawn.
 	Precision EvalPrecision // Whether we evaluated this node as an alpha/beta cutoff.
-	BestMove  EfficientMove
-	Ancient   bool          // Whether this has gone a full evaluation without being accessed.
-	Position  Position
+	BestMove  CompactMove
+}
+
+// ttSlot is an entry packed into two words. The data word holds
+//
+//	bits 0-15:  the best move, as a CompactMove
+//	bits 16-31: the evaluation in centipawns, as an int16
+//	bits 32-39: the depth
+//	bits 40-41: the precision
+//	bits 42-49: the generation of the search that stored it
+//
+// and the key is the full zobrist hash of the position, to tell apart
+// positions that share a bucket.
+//
+// Searches running at the same time can share a table without locks: both
+// words are read and written atomically, and the slot stores key^data
+// instead of the key. If two writers interleave, the words no longer match
+// and the slot simply looks empty to a reader, rather than returning one
+// position's data for another.
+type ttSlot struct {
+	check uint64 // key ^ data
+	data  uint64
+}
+
+// load returns the key and data of the slot. An empty slot has zero data,
+// and a slot torn by a concurrent write returns a key no position has.
+func (s *ttSlot) load() (key, data uint64) {
+	data = atomic.LoadUint64(&s.data)
+	return atomic.LoadUint64(&s.check) ^ data, data
+}
+
+func (s *ttSlot) store(key, data uint64) {
+	atomic.StoreUint64(&s.data, data)
+	atomic.StoreUint64(&s.check, key^data)
+}
+
+// ttBucket is a cache line worth of slots.
+type ttBucket [TT_BUCKET_SIZE]ttSlot
+
+// TransTable is a fixed-size transposition table, holding a list of
+// previously seen positions and their evaluation. Probe, Store, NewSearch
+// and Hashfull are safe to call from several goroutines at once, so
+// searches can share a table. Resize, Clear and Load are not, and must
+// only be called while no search is using the table.
+type TransTable struct {
+	buckets []ttBucket
+	mask    uint64
+	// generation counts searches, modulo 256. Entries from old
+	// generations are the first to be replaced.
+	generation uint32
+}
+
+// NewTransTable returns a table using at most mb megabytes of memory.
+func NewTransTable(mb int) *TransTable {
+	t := &TransTable{}
+	t.Resize(mb)
+	return t
+}
+
+// Resize reallocates the table to use at most mb megabytes of memory,
+// throwing away its contents. The number of buckets is a power of two so
+// that a hash can be turned into an index with a mask.
+func (t *TransTable) Resize(mb int) {
+	if mb < 1 {
+		mb = 1
+	}
+	n := uint64(mb) * 1024 * 1024 / uint64(TT_BUCKET_SIZE*16)
+	size := uint64(1)
+	for size*2 <= n {
+		size *= 2
+	}
+	t.buckets = make([]ttBucket, size)
+	t.mask = size - 1
+	t.generation = 0
+}
+
+// Clear empties the table.
+func (t *TransTable) Clear() {
+	for i := range t.buckets {
+		t.buckets[i] = ttBucket{}
+	}
+	t.generation = 0
+}
+
+// NewSearch ages every entry in the table by one search, without touching
+// them. Call it before each search so stale entries get replaced first.
+func (t *TransTable) NewSearch() {
+	atomic.AddUint32(&t.generation, 1)
 }
 
-func EraseOldTableEntries() {
-	var tt = map[uint64]TTEntry{}
-	for k, v := range TranspositionTable {
-		if !v.Ancient {
-			v.Ancient = true
-			tt[k] = v
+func (t *TransTable) currentGeneration() uint8 {
+	return uint8(atomic.LoadUint32(&t.generation))
+}
+
+// Probe returns the entry for the position with the given hash, if the
+// table has one.
+func (t *TransTable) Probe(hash uint64) (TTEntry, bool) {
+	bucket := &t.buckets[hash&t.mask]
+	for i := range bucket {
+		s := &bucket[i]
+		key, data := s.load()
+		if key != hash || data == 0 {
+			continue
+		}
+		// Mark this entry as useful to the current search.
+		if g := t.currentGeneration(); uint8(data>>42) != g {
+			s.store(hash, data&^(0xFF<<42)|uint64(g)<<42)
+		}
+		return unpackEntry(data), true
+	}
+	return TTEntry{}, false
+}
+
+// Store saves an entry for the position with the given hash. An existing
+// entry for the position is overwritten. Otherwise we replace whichever
+// entry in the bucket is the least valuable: shallow entries from old
+// searches go first.
+func (t *TransTable) Store(hash uint64, e TTEntry) {
+	bucket := &t.buckets[hash&t.mask]
+	generation := t.currentGeneration()
+	replace := &bucket[0]
+	worst := math.MaxInt32
+	for i := range bucket {
+		s := &bucket[i]
+		key, data := s.load()
+		if key == hash && data != 0 {
+			// Don't forget the best move just because this search didn't find one.
+			if e.BestMove == CompactMove(0) {
+				e.BestMove = unpackEntry(data).BestMove
+			}
+			replace = s
+			break
 		}
+		if data == 0 {
+			replace = s
+			break
+		}
+		age := int(generation - uint8(data>>42))
+		if worth := int(data>>32&0xFF) - 8*age; worth < worst {
+			worst = worth
+			replace = s
+		}
+	}
+	replace.store(hash, packEntry(e, generation))
+}
+
+// Hashfull returns how full the table is in permille, estimated from the
+// first thousand buckets, counting only entries from the current search.
+func (t *TransTable) Hashfull() int {
+	n := 1000 / TT_BUCKET_SIZE
+	if n > len(t.buckets) {
+		n = len(t.buckets)
+	}
+	generation := t.currentGeneration()
+	used := 0
+	for b := range t.buckets[:n] {
+		for i := range t.buckets[b] {
+			if _, data := t.buckets[b][i].load(); data != 0 && uint8(data>>42) == generation {
+				used++
+			}
+		}
+	}
+	return used * 1000 / (n * TT_BUCKET_SIZE)
+}
+
+func packEntry(e TTEntry, generation uint8) uint64 {
+	var score int
+	switch {
+	case math.IsInf(e.Eval, 1):
+		score = TT_INFINITE_SCORE
+	case math.IsInf(e.Eval, -1):
+		score = -TT_INFINITE_SCORE
+	default:
+		score = int(math.Round(e.Eval * 100))
+		if score > TT_MAX_SCORE {
+			score = TT_MAX_SCORE
+		}
+		if score < -TT_MAX_SCORE {
+			score = -TT_MAX_SCORE
+		}
+	}
+	depth := e.Depth
+	if depth < 0 {
+		depth = 0
+	}
+	if depth > 0xFF {
+		depth = 0xFF
+	}
+	data := uint64(e.BestMove)
+	data |= uint64(uint16(int16(score))) << 16
+	data |= uint64(depth) << 32
+	data |= uint64(e.Precision&0x3) << 40
+	data |= uint64(generation) << 42
+	// Never store an all zero word: that marks an empty slot.
+	data |= 1 << 63
+	return data
+}
+
+func unpackEntry(data uint64) TTEntry {
+	e := TTEntry{
+		BestMove:  CompactMove(data),
+		Depth:     int(data >> 32 & 0xFF),
+		Precision: EvalPrecision(data >> 40 & 0x3),
+	}
+	switch score := int(int16(data >> 16)); score {
+	case TT_INFINITE_SCORE:
+		e.Eval = math.Inf(1)
+	case -TT_INFINITE_SCORE:
+		e.Eval = math.Inf(-1)
+	default:
+		e.Eval = float64(score) / 100
 	}
-	TranspositionTable = tt
+	return e
 }
@@ -0,0 +1,178 @@
+// transposition_file.go saves transposition tables to disk, so that a long
+// analysis can pick up where an earlier session left off.
+package game
+
+import "bufio"
+import "encoding/binary"
+import "fmt"
+import "hash/crc32"
+import "io"
+import "os"
+
+// A table file is a header, the table's slots and a checksum:
+//
+//	bytes 0-3:   TT_FILE_MAGIC
+//	bytes 4-7:   the format version
+//	bytes 8-15:  a fingerprint of the zobrist keys the table was hashed with
+//	bytes 16-23: the number of buckets
+//	byte 24:     the generation, followed by 7 bytes of padding
+//	then the key and data word of every slot, and finally the CRC-32 of
+//	everything before it.
+//
+// Everything is little endian.
+const TT_FILE_MAGIC = "GFTT"
+const TT_FILE_VERSION = 1
+
+// TT_FILE_MAX_BUCKETS is the largest table we're willing to load, the
+// largest that NewTransTable builds. A damaged header can't make us try to
+// allocate more than that.
+const TT_FILE_MAX_BUCKETS = MAX_HASH_MB * 1024 * 1024 / (TT_BUCKET_SIZE * 16)
+
+const ttFileHeaderSize = 32
+
+// Save writes the table to w.
+func (t *TransTable) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	header := make([]byte, ttFileHeaderSize)
+	copy(header, TT_FILE_MAGIC)
+	binary.LittleEndian.PutUint32(header[4:], TT_FILE_VERSION)
+	binary.LittleEndian.PutUint64(header[8:], zobristFingerprint())
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(t.buckets)))
+	header[24] = t.currentGeneration()
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+	buf := make([]byte, 16*TT_BUCKET_SIZE)
+	for b := range t.buckets {
+		bucket := &t.buckets[b]
+		for i := range bucket {
+			key, data := bucket[i].load()
+			binary.LittleEndian.PutUint64(buf[16*i:], key)
+			binary.LittleEndian.PutUint64(buf[16*i+8:], data)
+		}
+		if _, err := out.Write(buf); err != nil {
+			return err
+		}
+	}
+	sum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sum, crc.Sum32())
+	if _, err := bw.Write(sum); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Load replaces the contents of the table with a table written by Save.
+// The table takes on the size of the saved one. If the file is damaged or
+// was made with different zobrist keys, the table is left untouched.
+func (t *TransTable) Load(r io.Reader) error {
+	return t.load(r, -1)
+}
+
+// load is Load for a file of size bytes, or of unknown size if size is
+// negative. A known size lets us reject a truncated file before
+// allocating the table its header asks for.
+func (t *TransTable) load(r io.Reader, size int64) error {
+	crc := crc32.NewIEEE()
+	in := io.TeeReader(bufio.NewReader(r), crc)
+
+	header := make([]byte, ttFileHeaderSize)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return fmt.Errorf("reading transposition table header: %v", err)
+	}
+	if string(header[:4]) != TT_FILE_MAGIC {
+		return fmt.Errorf("not a transposition table file")
+	}
+	if v := binary.LittleEndian.Uint32(header[4:]); v != TT_FILE_VERSION {
+		return fmt.Errorf("transposition table file has version %v, want %v", v, TT_FILE_VERSION)
+	}
+	if binary.LittleEndian.Uint64(header[8:]) != zobristFingerprint() {
+		return fmt.Errorf("transposition table file was hashed with different zobrist keys")
+	}
+	n := binary.LittleEndian.Uint64(header[16:])
+	if n == 0 || n > TT_FILE_MAX_BUCKETS || n&(n-1) != 0 {
+		return fmt.Errorf("transposition table file has invalid size %v", n)
+	}
+	if want := int64(ttFileHeaderSize + n*16*TT_BUCKET_SIZE + 4); size >= 0 && size != want {
+		return fmt.Errorf("transposition table file has %v bytes, want %v for %v buckets", size, want, n)
+	}
+
+	buckets := make([]ttBucket, n)
+	buf := make([]byte, 16*TT_BUCKET_SIZE)
+	for b := range buckets {
+		if _, err := io.ReadFull(in, buf); err != nil {
+			return fmt.Errorf("reading transposition table: %v", err)
+		}
+		for i := range buckets[b] {
+			key := binary.LittleEndian.Uint64(buf[16*i:])
+			data := binary.LittleEndian.Uint64(buf[16*i+8:])
+			buckets[b][i] = ttSlot{check: key ^ data, data: data}
+		}
+	}
+	want := crc.Sum32()
+	sum := make([]byte, 4)
+	if _, err := io.ReadFull(in, sum); err != nil {
+		return fmt.Errorf("reading transposition table checksum: %v", err)
+	}
+	if got := binary.LittleEndian.Uint32(sum); got != want {
+		return fmt.Errorf("transposition table file is corrupt: checksum %08x, want %08x", got, want)
+	}
+
+	t.buckets = buckets
+	t.mask = n - 1
+	t.generation = uint32(header[24])
+	return nil
+}
+
+// SaveFile writes the table to the file at path.
+func (t *TransTable) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := t.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile replaces the contents of the table with the file at path.
+func (t *TransTable) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return t.load(f, fi.Size())
+}
+
+// zobristFingerprint condenses every zobrist key into one number, so we
+// can tell whether a saved table was hashed with the keys we have now.
+func zobristFingerprint() uint64 {
+	h := uint64(14695981039346656037)
+	mix := func(k uint64) {
+		h = (h ^ k) * 1099511628211
+	}
+	for _, squares := range ZOBRISTPIECES {
+		for _, k := range squares {
+			mix(k)
+		}
+	}
+	for _, k := range ZOBRISTEP {
+		mix(k)
+	}
+	mix(ZOBRISTTURN)
+	mix(ZOBRISTWKS)
+	mix(ZOBRISTWQS)
+	mix(ZOBRISTBKS)
+	mix(ZOBRISTBQS)
+	return h
+}
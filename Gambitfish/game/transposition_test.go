@@ -0,0 +1,225 @@
+package game
+
+import "bytes"
+import "encoding/binary"
+import "fmt"
+import "math"
+import "os"
+import "path/filepath"
+import "sync"
+import "testing"
+
+func TestTransTableRoundTrip(t *testing.T) {
+	move := NewEfficientMove(WHITEPAWN, E8, E7).AddPromotion(WHITEKNIGHT)
+	testCases := []struct {
+		name  string
+		entry TTEntry
+	}{
+		{
+			name:  "exact",
+			entry: TTEntry{Depth: 5, Eval: 1.25, Precision: EvalExact, BestMove: move.Compact()},
+		}, {
+			name:  "negative lower bound",
+			entry: TTEntry{Depth: 1, Eval: -3.5, Precision: EvalLowerBound},
+		}, {
+			name:  "mate",
+			entry: TTEntry{Depth: 12, Eval: math.Inf(1), Precision: EvalUpperBound},
+		}, {
+			name:  "mated",
+			entry: TTEntry{Depth: 0, Eval: math.Inf(-1), Precision: EvalExact},
+		},
+	}
+	tt := NewTransTable(1)
+	for i, tc := range testCases {
+		hash := uint64(i+1) * 0x9E3779B97F4A7C15
+		tt.Store(hash, tc.entry)
+		got, ok := tt.Probe(hash)
+		if !ok {
+			t.Errorf("%v: entry not found", tc.name)
+			continue
+		}
+		if got != tc.entry {
+			t.Errorf("%v: got %+v, want %+v", tc.name, got, tc.entry)
+		}
+	}
+	if _, ok := tt.Probe(0xDEADBEEF); ok {
+		t.Errorf("found an entry that was never stored")
+	}
+	if got := move.Compact().Resolve([]EfficientMove{NewEfficientMove(WHITEPAWN, E8, E7).AddPromotion(WHITEQUEEN), move}); got != move {
+		t.Errorf("resolve compact move: got %v, want %v", got, move)
+	}
+}
+
+func TestTransTableReplacement(t *testing.T) {
+	tt := NewTransTable(1)
+	// Hashes that differ only above the mask share a bucket.
+	stride := tt.mask + 1
+	for i := 0; i < TT_BUCKET_SIZE; i++ {
+		tt.Store(uint64(i+1)*stride, TTEntry{Depth: 10 - i})
+	}
+	// A full bucket gives up its shallowest entry.
+	tt.Store(uint64(TT_BUCKET_SIZE+1)*stride, TTEntry{Depth: 3})
+	if _, ok := tt.Probe(uint64(TT_BUCKET_SIZE) * stride); ok {
+		t.Errorf("shallowest entry survived replacement")
+	}
+	if _, ok := tt.Probe(stride); !ok {
+		t.Errorf("deepest entry was replaced")
+	}
+
+	// Entries from old searches are replaced before deeper fresh ones.
+	tt.Clear()
+	for i := 0; i < TT_BUCKET_SIZE; i++ {
+		tt.Store(uint64(i+1)*stride, TTEntry{Depth: 10})
+		tt.NewSearch()
+	}
+	tt.Store(uint64(TT_BUCKET_SIZE+1)*stride, TTEntry{Depth: 1})
+	if _, ok := tt.Probe(stride); ok {
+		t.Errorf("oldest entry survived replacement")
+	}
+	for i := 1; i < TT_BUCKET_SIZE; i++ {
+		if _, ok := tt.Probe(uint64(i+1) * stride); !ok {
+			t.Errorf("entry %v from a newer search was replaced", i)
+		}
+	}
+}
+
+func TestTransTableSaveLoad(t *testing.T) {
+	InitInternalData()
+	tt := NewTransTable(1)
+	entries := map[uint64]TTEntry{
+		0x1234:                      {Depth: 7, Eval: 0.5, Precision: EvalExact},
+		0xABCDEF0123456789:          {Depth: 2, Eval: math.Inf(-1), Precision: EvalUpperBound},
+		ZobristHash(DefaultBoard()): {Depth: 9, Eval: 0.2, Precision: EvalLowerBound, BestMove: NewEfficientMove(WHITEPAWN, E4, E2).Compact()},
+	}
+	for h, e := range entries {
+		tt.Store(h, e)
+	}
+	var buf bytes.Buffer
+	if err := tt.Save(&buf); err != nil {
+		t.Fatalf("saving table: %v", err)
+	}
+	saved := buf.Bytes()
+
+	loaded := NewTransTable(2)
+	if err := loaded.Load(bytes.NewReader(saved)); err != nil {
+		t.Fatalf("loading table: %v", err)
+	}
+	if len(loaded.buckets) != len(tt.buckets) {
+		t.Errorf("loaded table has %v buckets, want %v", len(loaded.buckets), len(tt.buckets))
+	}
+	for h, want := range entries {
+		if got, ok := loaded.Probe(h); !ok || got != want {
+			t.Errorf("entry %x: got %+v (found %v), want %+v", h, got, ok, want)
+		}
+	}
+
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), saved...))
+	}
+	testCases := []struct {
+		name string
+		file []byte
+	}{
+		{
+			name: "empty",
+			file: nil,
+		}, {
+			name: "bad magic",
+			file: corrupt(func(b []byte) []byte { b[0] = 'X'; return b }),
+		}, {
+			name: "new version",
+			file: corrupt(func(b []byte) []byte { b[4]++; return b }),
+		}, {
+			name: "other zobrist keys",
+			file: corrupt(func(b []byte) []byte { b[8]++; return b }),
+		}, {
+			name: "flipped bit",
+			file: corrupt(func(b []byte) []byte { b[len(b)/2] ^= 1; return b }),
+		}, {
+			name: "truncated",
+			file: saved[:len(saved)-1],
+		}, {
+			name: "2^31 buckets",
+			file: corrupt(func(b []byte) []byte { binary.LittleEndian.PutUint64(b[16:], 1<<31); return b }),
+		},
+	}
+	for _, tc := range testCases {
+		if err := loaded.Load(bytes.NewReader(tc.file)); err == nil {
+			t.Errorf("%v: loaded a bad file", tc.name)
+		}
+	}
+	// Failed loads leave the table as it was.
+	for h, want := range entries {
+		if got, ok := loaded.Probe(h); !ok || got != want {
+			t.Errorf("entry %x after failed loads: got %+v (found %v), want %+v", h, got, ok, want)
+		}
+	}
+}
+
+// Test that LoadFile rejects a file too short for the table its header
+// describes, before allocating that table.
+func TestTransTableLoadFileTruncated(t *testing.T) {
+	InitInternalData()
+	var buf bytes.Buffer
+	if err := NewTransTable(1).Save(&buf); err != nil {
+		t.Fatalf("saving table: %v", err)
+	}
+	header := buf.Bytes()[:ttFileHeaderSize]
+	binary.LittleEndian.PutUint64(header[16:], TT_FILE_MAX_BUCKETS)
+	path := filepath.Join(t.TempDir(), "tt")
+	if err := os.WriteFile(path, header, 0644); err != nil {
+		t.Fatalf("writing table: %v", err)
+	}
+	tt := NewTransTable(1)
+	if err := tt.LoadFile(path); err == nil {
+		t.Errorf("loaded a header with no table")
+	}
+	if len(tt.buckets) != 1024*1024/(TT_BUCKET_SIZE*16) {
+		t.Errorf("failed load resized the table to %v buckets", len(tt.buckets))
+	}
+}
+
+// Test that goroutines sharing a table never see one position's entry for
+// another's. Run with -race.
+func TestTransTableConcurrent(t *testing.T) {
+	tt := NewTransTable(1)
+	stride := tt.mask + 1
+	// Every entry can be derived from its hash, so readers can check it.
+	entry := func(hash uint64) TTEntry {
+		return TTEntry{Depth: int(hash % 64), Eval: float64(hash%1000) / 100, Precision: EvalExact}
+	}
+	// Crowd a few buckets so writers fight over the same slots.
+	hash := func(i int) uint64 {
+		return uint64(i%8) + uint64(i)*stride*7919
+	}
+	var wg sync.WaitGroup
+	errs := make(chan string, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 20000; i++ {
+				h := hash((i*31 + g*17) % 500)
+				if i%3 == 0 {
+					tt.Store(h, entry(h))
+					continue
+				}
+				if i%1000 == 0 {
+					tt.NewSearch()
+				}
+				if got, ok := tt.Probe(h); ok && (got.Depth != entry(h).Depth || got.Eval != entry(h).Eval) {
+					select {
+					case errs <- fmt.Sprintf("hash %x: got %+v, want %+v", h, got, entry(h)):
+					default:
+					}
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,64 @@
+// validate.go checks that a board set up from outside the engine is a
+// position we can play from. The move generator and evaluators assume
+// these invariants, and can crash or return nonsense without them.
+package game
+
+import "fmt"
+import "math/bits"
+
+// Validate returns an error describing the first way in which b isn't a
+// legal position: each side must have exactly one king, the side not to
+// move can't be in check, pawns can't be on the first or last rank,
+// castling rights need the king and rook on their starting squares, and
+// an en passant square needs the pawn that just advanced two.
+func (b *Board) Validate() error {
+	pos := &b.Position
+	for _, k := range []struct {
+		c     Color
+		kings uint64
+	}{{WHITE, pos.WhiteKing}, {BLACK, pos.BlackKing}} {
+		switch n := bits.OnesCount64(k.kings); n {
+		case 0:
+			return fmt.Errorf("%v has no king", k.c)
+		case 1:
+		default:
+			return fmt.Errorf("%v has %v kings", k.c, n)
+		}
+	}
+	if IsCheck(b, -1*b.Active) {
+		return fmt.Errorf("%v is in check, but it's %v to move", -1*b.Active, b.Active)
+	}
+	const backRanks = uint64(0xFF000000000000FF)
+	if pawns := (pos.WhitePawns | pos.BlackPawns) & backRanks; pawns != 0 {
+		return fmt.Errorf("pawn on the back rank: %v", Square(bits.TrailingZeros64(pawns)))
+	}
+	for _, r := range []struct {
+		has        bool
+		name       string
+		king, rook Piece
+		kingSquare Square
+		rookSquare Square
+	}{
+		{b.WKSCastling, "K", WHITEKING, WHITEROOK, E1, H1},
+		{b.WQSCastling, "Q", WHITEKING, WHITEROOK, E1, A1},
+		{b.BKSCastling, "k", BLACKKING, BLACKROOK, E8, H8},
+		{b.BQSCastling, "q", BLACKKING, BLACKROOK, E8, A8},
+	} {
+		if r.has && (b.Squares[r.kingSquare] != r.king || b.Squares[r.rookSquare] != r.rook) {
+			return fmt.Errorf("impossible castling right %v: king or rook has moved", r.name)
+		}
+	}
+	if ep := b.EPSquare; ep != OFFBOARD_SQUARE {
+		pawn, row, behind := WHITEPAWN, 4, ep-8
+		if b.Active == WHITE {
+			pawn, row, behind = BLACKPAWN, 5, ep+8
+		}
+		if ep.Row() != row || b.Squares[ep] != pawn {
+			return fmt.Errorf("impossible en passant square: no pawn just advanced two to %v", ep)
+		}
+		if b.Squares[behind] != NULLPIECE {
+			return fmt.Errorf("impossible en passant square: %v is occupied", behind)
+		}
+	}
+	return nil
+}
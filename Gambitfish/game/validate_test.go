@@ -0,0 +1,68 @@
+package game
+
+import "strings"
+import "testing"
+
+func TestValidate(t *testing.T) {
+	InitInternalData()
+	testCases := []struct {
+		name string
+		fen  string
+		want string // A part of the error, or empty for a valid board.
+	}{
+		{
+			name: "starting board",
+			fen:  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		}, {
+			name: "en passant",
+			fen:  "rnbqkbnr/1pp1pppp/p7/3pP3/8/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 3",
+		}, {
+			name: "no black king",
+			fen:  "8/8/8/8/8/8/8/4K3 w - - 0 1",
+			want: "BLACK has no king",
+		}, {
+			name: "two white kings",
+			fen:  "4k3/8/8/8/8/8/8/3KK3 w - - 0 1",
+			want: "WHITE has 2 kings",
+		}, {
+			name: "side not to move in check",
+			fen:  "4k3/8/8/8/8/8/8/4RK2 w - - 0 1",
+			want: "BLACK is in check",
+		}, {
+			name: "kings next to each other",
+			fen:  "8/8/8/8/8/8/4k3/4K3 b - - 0 1",
+			want: "WHITE is in check",
+		}, {
+			name: "pawn on the last rank",
+			fen:  "3Pk3/8/8/8/8/8/8/4K3 w - - 0 1",
+			want: "pawn on the back rank",
+		}, {
+			name: "pawn on the first rank",
+			fen:  "4k3/8/8/8/8/8/8/p3K3 w - - 0 1",
+			want: "pawn on the back rank",
+		}, {
+			name: "castling without a rook",
+			fen:  "4k3/8/8/8/8/8/8/4K3 w K - 0 1",
+			want: "impossible castling right K",
+		}, {
+			name: "castling after the king moved",
+			fen:  "r4k1r/8/8/8/8/8/8/4K3 w kq - 0 1",
+			want: "impossible castling right k",
+		}, {
+			name: "en passant with no pawn",
+			fen:  "4k3/8/8/8/8/8/8/4K3 b - e3 0 1",
+			want: "impossible en passant square",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := BoardFromFen(tc.fen)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%v: got error %v, want none", tc.name, err)
+		case tc.want != "" && err == nil:
+			t.Errorf("%v: got no error, want %v", tc.name, tc.want)
+		case tc.want != "" && !strings.Contains(err.Error(), tc.want):
+			t.Errorf("%v: got error %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
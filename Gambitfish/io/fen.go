@@ -0,0 +1,75 @@
+// fen.go reads positions sent by a GUI: a FEN string or the starting
+// position, followed by the moves played from it.
+package io
+
+import "fmt"
+import "strings"
+import "../game"
+
+// STARTPOS_FEN is the fen for the standard starting position.
+const STARTPOS_FEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// ParsePosition builds a board from the arguments of a UCI position
+// command, e.g. "startpos moves e2e4 e7e5" or "fen <fen> moves e2e4".
+func ParsePosition(args []string) (*game.Board, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("position command is missing a position")
+	}
+	var fen string
+	var rest []string
+	switch args[0] {
+	case "startpos":
+		fen = STARTPOS_FEN
+		rest = args[1:]
+	case "fen":
+		i := 1
+		for i < len(args) && args[i] != "moves" {
+			i++
+		}
+		fen = strings.Join(args[1:i], " ")
+		rest = args[i:]
+	default:
+		return nil, fmt.Errorf("unknown position type: %v", args[0])
+	}
+	b, err := game.BoardFromFen(fen)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 {
+		return b, nil
+	}
+	if rest[0] != "moves" {
+		return nil, fmt.Errorf("expected moves after position, got %v", rest[0])
+	}
+	for _, s := range rest[1:] {
+		m, err := ParseMove(b, s)
+		if err != nil {
+			return nil, err
+		}
+		b.Push(m)
+	}
+	return b, nil
+}
+
+// ParseMove finds the legal move on b written in long algebraic notation,
+// such as e2e4, e1g1 for castling or e7e8q for a promotion.
+func ParseMove(b *game.Board, s string) (game.EfficientMove, error) {
+	for _, m := range b.AllLegalMoves() {
+		if MoveString(m) == s {
+			return m, nil
+		}
+	}
+	return game.EfficientMove(0), fmt.Errorf("illegal move: %v", s)
+}
+
+// MoveString writes a move in long algebraic notation.
+func MoveString(m game.EfficientMove) string {
+	if m == game.EfficientMove(0) {
+		return "0000"
+	}
+	s := m.Old().String() + m.Square().String()
+	if m.Promotion() != game.NULLPIECE {
+		s += strings.ToLower(m.Promotion().String())
+	}
+	return s
+}
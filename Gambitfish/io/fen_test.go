@@ -0,0 +1,67 @@
+package io
+
+import "testing"
+import "../game"
+
+func TestParsePosition(t *testing.T) {
+	game.InitInternalData()
+	testCases := []struct {
+		name     string
+		args     []string
+		want     string // The fen of the resulting board.
+		lastMove string
+	}{
+		{
+			name: "start position",
+			args: []string{"startpos"},
+			want: STARTPOS_FEN,
+		}, {
+			name:     "start position with moves",
+			args:     []string{"startpos", "moves", "e2e4", "e7e5", "g1f3"},
+			want:     "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2",
+			lastMove: "g1f3",
+		}, {
+			name:     "fen with castling and promotion",
+			args:     []string{"fen", "4k3/1P6/8/8/8/8/8/R3K3", "w", "Q", "-", "0", "1", "moves", "e1c1", "e8f7", "b7b8n"},
+			want:     "1N6/5k2/8/8/8/8/8/2KR4 b - - 0 2",
+			lastMove: "b7b8n",
+		},
+	}
+	for _, tc := range testCases {
+		b, err := ParsePosition(tc.args)
+		if err != nil {
+			t.Errorf("%v: error parsing position: %v", tc.name, err)
+			continue
+		}
+		want, err := game.BoardFromFen(tc.want)
+		if err != nil {
+			t.Fatalf("%v: error reading fen %v: %v", tc.name, tc.want, err)
+		}
+		if b.Position != want.Position || b.Active != want.Active || b.Move != want.Move || b.HalfMoveClock != want.HalfMoveClock {
+			t.Errorf("%v: got a different board than %v", tc.name, tc.want)
+			b.Print()
+		}
+		if tc.lastMove != "" && MoveString(b.LastMove) != tc.lastMove {
+			t.Errorf("%v: got last move %v, want %v", tc.name, MoveString(b.LastMove), tc.lastMove)
+		}
+	}
+}
+
+func TestParsePositionErrors(t *testing.T) {
+	game.InitInternalData()
+	testCases := []struct {
+		name string
+		args []string
+	}{
+		{"missing position", []string{}},
+		{"unknown position type", []string{"middlegame"}},
+		{"illegal move", []string{"startpos", "moves", "e2e5"}},
+		{"garbage after position", []string{"startpos", "e2e4"}},
+		{"position without a king", []string{"fen", "8/8/8/8/8/8/8/4K3", "w", "-", "-", "0", "1"}},
+	}
+	for _, tc := range testCases {
+		if _, err := ParsePosition(tc.args); err == nil {
+			t.Errorf("%v: expected an error parsing %v", tc.name, tc.args)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+// Package io speaks the Universal Chess Interface, so that Gambitfish can
+// be run from chess GUIs and play against other engines.
+// http://wbec-ridderkerk.nl/html/UCIProtocol.html
+package io
+
+import "bufio"
+import "fmt"
+import "io"
+import "math"
+import "strconv"
+import "strings"
+import "sync"
+import "time"
+import "../game"
+import "../engine/search"
+
+// MAX_SEARCH_DEPTH is how deep we search when told to think until stopped.
+const MAX_SEARCH_DEPTH = 64
+
+// MATE_SCORE_CP is the centipawn score reported for a forced mate, since
+// the search doesn't know how many moves away the mate is.
+const MATE_SCORE_CP = 32000
+
+// DEFAULT_MOVES_TO_GO is how many more moves we assume the game lasts when
+// dividing up our remaining time.
+const DEFAULT_MOVES_TO_GO = 30
+
+// UCI is an engine controlled through the UCI protocol.
+type UCI struct {
+	// Engine searches the positions the GUI sends us. Options like
+	// Contempt and Hash are set on it.
+	Engine *search.Engine
+	// Depth is how deep we search when the GUI gives us no limits.
+	Depth int
+	// HashFile is where the transposition table is saved to and loaded
+	// from, unless a savehash or loadhash command names another file.
+	HashFile string
+
+	out   io.Writer
+	outMu sync.Mutex
+	board *game.Board
+
+	// done is closed when the search in progress has sent its bestmove,
+	// and is nil when we aren't searching.
+	done chan struct{}
+	// release is closed to let a ponder or infinite search send its
+	// bestmove. The protocol forbids sending it before stop or ponderhit.
+	release chan struct{}
+	// ponderBudget is how long to keep thinking once a ponder search
+	// becomes a normal search.
+	ponderBudget time.Duration
+}
+
+// NewUCI returns a UCI engine that searches with en and writes its
+// responses to out.
+func NewUCI(en *search.Engine, depth int, out io.Writer) *UCI {
+	return &UCI{
+		Engine: en,
+		Depth:  depth,
+		out:    out,
+		board:  game.DefaultBoard(),
+	}
+}
+
+// Run reads commands from in until it is closed or the GUI says quit.
+func (u *UCI) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		if quit := u.Handle(scanner.Text()); quit {
+			return nil
+		}
+	}
+	u.stopSearch()
+	return scanner.Err()
+}
+
+// Handle executes a single command, returning true if the GUI asked us to
+// quit.
+func (u *UCI) Handle(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false
+	}
+	args := fields[1:]
+	switch fields[0] {
+	case "uci":
+		u.send("id name Gambitfish")
+		u.send("id author Stefan Isenberger")
+		u.send(fmt.Sprintf("option name Hash type spin default %v min 1 max %v", game.DEFAULT_HASH_MB, game.MAX_HASH_MB))
+		u.send("option name Contempt type spin default 0 min -100 max 100")
+		u.send("option name Ponder type check default false")
+		u.send("option name HashFile type string default <empty>")
+		u.send("option name Save Hash type button")
+		u.send("option name Load Hash type button")
+		u.send("uciok")
+	case "isready":
+		u.send("readyok")
+	case "setoption":
+		u.setOption(args)
+	case "ucinewgame":
+		u.stopSearch()
+		u.Engine.NewGame()
+		u.board = game.DefaultBoard()
+	case "position":
+		u.stopSearch()
+		b, err := ParsePosition(args)
+		if err != nil {
+			u.send(fmt.Sprintf("info string %v", err))
+			return false
+		}
+		u.board = b
+	case "go":
+		u.stopSearch()
+		u.goSearch(args)
+	case "savehash":
+		u.stopSearch()
+		u.saveHash(strings.Join(args, " "))
+	case "loadhash":
+		u.stopSearch()
+		u.loadHash(strings.Join(args, " "))
+	case "ponderhit":
+		u.ponderHit()
+	case "stop":
+		u.stopSearch()
+	case "quit":
+		u.stopSearch()
+		return true
+	default:
+		u.send(fmt.Sprintf("info string unknown command: %v", fields[0]))
+	}
+	return false
+}
+
+// setOption handles "setoption name <name> value <value>".
+func (u *UCI) setOption(args []string) {
+	if len(args) < 2 || args[0] != "name" {
+		return
+	}
+	var name, value string
+	for i := 1; i < len(args); i++ {
+		if args[i] == "value" {
+			value = strings.Join(args[i+1:], " ")
+			break
+		}
+		name = strings.TrimSpace(name + " " + args[i])
+	}
+	switch strings.ToLower(name) {
+	case "contempt":
+		cp, err := strconv.Atoi(value)
+		if err != nil {
+			u.send(fmt.Sprintf("info string invalid contempt: %v", value))
+			return
+		}
+		u.stopSearch()
+		u.Engine.Contempt = float64(cp) / 100
+	case "hash":
+		mb, err := strconv.Atoi(value)
+		if err != nil || mb < 1 || mb > game.MAX_HASH_MB {
+			u.send(fmt.Sprintf("info string invalid hash size: %v", value))
+			return
+		}
+		u.stopSearch()
+		u.Engine.TT.Resize(mb)
+	case "hashfile":
+		if value == "<empty>" {
+			value = ""
+		}
+		u.HashFile = value
+	case "save hash":
+		u.stopSearch()
+		u.saveHash("")
+	case "load hash":
+		u.stopSearch()
+		u.loadHash("")
+	case "ponder":
+		// Nothing to set up: we ponder whenever the GUI says "go ponder".
+	default:
+		u.send(fmt.Sprintf("info string unknown option: %v", name))
+	}
+}
+
+// saveHash writes the transposition table to path, or to HashFile if path
+// is empty.
+func (u *UCI) saveHash(path string) {
+	if path == "" {
+		path = u.HashFile
+	}
+	if path == "" {
+		u.send("info string no hash file to save to")
+		return
+	}
+	if err := u.Engine.TT.SaveFile(path); err != nil {
+		u.send(fmt.Sprintf("info string saving hash: %v", err))
+		return
+	}
+	u.send(fmt.Sprintf("info string saved hash to %v", path))
+}
+
+// loadHash reads the transposition table from path, or from HashFile if
+// path is empty.
+func (u *UCI) loadHash(path string) {
+	if path == "" {
+		path = u.HashFile
+	}
+	if path == "" {
+		u.send("info string no hash file to load from")
+		return
+	}
+	if err := u.Engine.TT.LoadFile(path); err != nil {
+		u.send(fmt.Sprintf("info string loading hash: %v", err))
+		return
+	}
+	u.send(fmt.Sprintf("info string loaded hash from %v", path))
+}
+
+// goSearch starts searching the current position in the background, with
+// the limits given in the arguments of a go command.
+func (u *UCI) goSearch(args []string) {
+	depth := 0
+	ponder := false
+	infinite := false
+	var moveTime, wtime, btime, winc, binc time.Duration
+	movesToGo := 0
+	for i := 0; i < len(args); i++ {
+		// Most limits are followed by a number.
+		n := 0
+		if i+1 < len(args) {
+			n, _ = strconv.Atoi(args[i+1])
+		}
+		ms := time.Duration(n) * time.Millisecond
+		switch args[i] {
+		case "ponder":
+			ponder = true
+		case "infinite":
+			infinite = true
+		case "depth":
+			depth = n
+			i++
+		case "movetime":
+			moveTime = ms
+			i++
+		case "wtime":
+			wtime = ms
+			i++
+		case "btime":
+			btime = ms
+			i++
+		case "winc":
+			winc = ms
+			i++
+		case "binc":
+			binc = ms
+			i++
+		case "movestogo":
+			movesToGo = n
+			i++
+		}
+	}
+	budget := moveTime
+	if budget == 0 {
+		if u.board.Active == game.WHITE && wtime > 0 {
+			budget = timeBudget(wtime, winc, movesToGo)
+		}
+		if u.board.Active == game.BLACK && btime > 0 {
+			budget = timeBudget(btime, binc, movesToGo)
+		}
+	}
+	// Without a depth limit, search until we're stopped or out of time.
+	if depth == 0 {
+		depth = u.Depth
+		if infinite || ponder || budget > 0 {
+			depth = MAX_SEARCH_DEPTH
+		}
+	}
+
+	u.Engine.Reset()
+	if budget > 0 && !ponder && !infinite {
+		u.Engine.SetDeadline(time.Now().Add(budget))
+	}
+	u.ponderBudget = budget
+
+	u.done = make(chan struct{})
+	u.release = make(chan struct{})
+	if !ponder && !infinite {
+		close(u.release)
+	}
+	b := u.board
+	done := u.done
+	release := u.release
+	go func() {
+		defer close(done)
+		res := u.Engine.IterativeDeepening(b, depth, u.sendInfo)
+		<-release
+		bestMove := fmt.Sprintf("bestmove %v", MoveString(res.Move))
+		if res.Move != game.EfficientMove(0) {
+			if reply := u.Engine.ExpectedReply(b, res.Move); reply != game.EfficientMove(0) {
+				bestMove += fmt.Sprintf(" ponder %v", MoveString(reply))
+			}
+		}
+		u.send(bestMove)
+	}()
+}
+
+// ponderHit turns the ponder search into a normal search: the opponent
+// played the move we were pondering on, so our clock is now running.
+func (u *UCI) ponderHit() {
+	if u.done == nil {
+		return
+	}
+	if u.ponderBudget > 0 {
+		u.Engine.SetDeadline(time.Now().Add(u.ponderBudget))
+	}
+	select {
+	case <-u.release:
+	default:
+		close(u.release)
+	}
+}
+
+// stopSearch ends the search in progress, if any, and waits for it to
+// send its bestmove.
+func (u *UCI) stopSearch() {
+	if u.done == nil {
+		return
+	}
+	u.Engine.Stop()
+	select {
+	case <-u.release:
+	default:
+		close(u.release)
+	}
+	<-u.done
+	u.done = nil
+	u.release = nil
+}
+
+// sendInfo reports a completed iteration of the search.
+func (u *UCI) sendInfo(r search.Result) {
+	u.send(fmt.Sprintf("info depth %v seldepth %v score cp %v nodes %v nps %.0f time %v hashfull %v pv %v",
+		r.Depth, r.Stats.SelDepth, centipawns(r.Eval), r.Stats.AllNodes(), r.Stats.NPS(),
+		r.Stats.Time.Milliseconds(), u.Engine.TT.Hashfull(), MoveString(r.Move)))
+}
+
+func (u *UCI) send(s string) {
+	u.outMu.Lock()
+	defer u.outMu.Unlock()
+	fmt.Fprintln(u.out, s)
+}
+
+// timeBudget decides how long to think about a move given the time left
+// on our clock and our increment.
+func timeBudget(remaining, inc time.Duration, movesToGo int) time.Duration {
+	if movesToGo <= 0 {
+		movesToGo = DEFAULT_MOVES_TO_GO
+	}
+	budget := remaining/time.Duration(movesToGo) + inc/2
+	// Leave some time on the clock, whatever happens.
+	if budget > remaining/2 {
+		budget = remaining / 2
+	}
+	return budget
+}
+
+// centipawns converts an evaluation in pawns to the centipawns UCI expects.
+func centipawns(eval float64) int {
+	if math.IsInf(eval, 1) || eval*100 > MATE_SCORE_CP {
+		return MATE_SCORE_CP
+	}
+	if math.IsInf(eval, -1) || eval*100 < -MATE_SCORE_CP {
+		return -MATE_SCORE_CP
+	}
+	return int(math.Round(eval * 100))
+}
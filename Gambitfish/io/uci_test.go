@@ -0,0 +1,49 @@
+package io
+
+import "bytes"
+import "strings"
+import "testing"
+import "time"
+import "../game"
+import "../engine/search"
+
+// Test that setting an option stops the search in progress before
+// changing what it reads. Run with -race.
+func TestSetOptionWhileSearching(t *testing.T) {
+	game.InitInternalData()
+	e := game.CompoundEvaluator{
+		Evaluators: []game.Evaluator{
+			game.MaterialEvaluator{},
+			game.PieceSquareEvaluator{},
+		},
+	}
+	testCases := []struct {
+		option string
+		ok     func(en *search.Engine) bool
+	}{
+		{
+			option: "setoption name Contempt value 20",
+			ok:     func(en *search.Engine) bool { return en.Contempt == .2 },
+		}, {
+			// Shrinking the table under a search could leave it probing
+			// past the end.
+			option: "setoption name Hash value 1",
+			ok:     func(en *search.Engine) bool { return en.TT.Hashfull() == 0 },
+		},
+	}
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		u := NewUCI(search.NewEngine(e, 2), 7, &out)
+		u.Handle("position startpos")
+		u.Handle("go infinite")
+		time.Sleep(10 * time.Millisecond)
+		u.Handle(tc.option)
+		if !strings.Contains(out.String(), "bestmove") {
+			t.Errorf("%v: the search was still running after the option was set", tc.option)
+		}
+		if !tc.ok(u.Engine) {
+			t.Errorf("%v: the option wasn't set", tc.option)
+		}
+		u.Handle("quit")
+	}
+}
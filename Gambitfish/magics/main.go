@@ -0,0 +1,103 @@
+// Command magics checks the magic bitboard tables in game/internal.go, or
+// finds new ones.
+//
+//	magics
+//
+// works out every blocker mask and shift from scratch and checks each
+// magic number against every occupancy of its mask.
+//
+//	magics -generate -seed 7 > tables.txt
+//
+// finds a new set of magic numbers, checks them the same way and prints
+// the tables as Go source to replace the ones in internal.go.
+package main
+
+import "../game"
+import "flag"
+import "fmt"
+import "log"
+import "math/rand"
+import "os"
+import "strings"
+
+var generate = flag.Bool("generate", false, "Find new magic numbers and print them as Go source.")
+var seed = flag.Int64("seed", 1, "Seed for the random magic number candidates.")
+
+// slider is one kind of sliding piece, and its tables in internal.go.
+type slider struct {
+	name    string
+	suffix  string // The suffix of its table names, e.g. ROOK.
+	mask    func(game.Square) uint64
+	attacks func(game.Square, uint64) uint64
+	magics  *[64]game.Magic
+}
+
+var sliders = []slider{
+	{"rook", "ROOK", game.RookMask, game.RookMovesOnBoard, &game.ROOKMAGICS},
+	{"bishop", "BISHOP", game.BishopMask, game.BishopMovesOnBoard, &game.BISHOPMAGICS},
+}
+
+func main() {
+	flag.Parse()
+	game.InitInternalData()
+	if *generate {
+		generateTables()
+		return
+	}
+	failed := false
+	for _, sl := range sliders {
+		bad := 0
+		for s := game.Square(0); s < 64; s++ {
+			if err := game.VerifyMagic(s, sl.magics[s], sl.mask(s), sl.attacks); err != nil {
+				fmt.Println(fmt.Sprintf("FAIL %v: %v", sl.name, err))
+				bad++
+			}
+		}
+		fmt.Println(fmt.Sprintf("%v magics: %v of 64 ok", sl.name, 64-bad))
+		failed = failed || bad > 0
+	}
+	n := len(game.SLIDERATTACKS)
+	fmt.Println(fmt.Sprintf("shared attack table: %v entries, %v KB", n, n*8/1024))
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// generateTables finds and checks a magic number for every square, and
+// prints the masks, magics and shifts.
+func generateTables() {
+	r := rand.New(rand.NewSource(*seed))
+	var size uint64
+	for _, sl := range sliders {
+		var found [64]game.Magic
+		for s := game.Square(0); s < 64; s++ {
+			m, err := game.FindMagic(s, sl.mask(s), sl.attacks, r)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := game.VerifyMagic(s, m, sl.mask(s), sl.attacks); err != nil {
+				log.Fatal(err)
+			}
+			found[s] = m
+			size += m.Size()
+		}
+		printTable("BLOCKERMASK"+sl.suffix, found, func(m game.Magic) string { return fmt.Sprintf("0x%016X", m.Mask) }, 4)
+		printTable("MAGICNUMBER"+sl.suffix, found, func(m game.Magic) string { return fmt.Sprintf("0x%016X", m.Number) }, 4)
+		printTable("SHIFTSIZE"+sl.suffix, found, func(m game.Magic) string { return fmt.Sprintf("%v", m.Shift) }, 8)
+	}
+	log.Printf("shared attack table: %v entries, %v KB", size, size*8/1024)
+}
+
+// printTable prints a [64]uint64 declaration with perLine values a line.
+func printTable(name string, magics [64]game.Magic, value func(game.Magic) string, perLine int) {
+	fmt.Println(fmt.Sprintf("var %v = [64]uint64{", name))
+	for i := 0; i < 64; i += perLine {
+		var line []string
+		for _, m := range magics[i : i+perLine] {
+			line = append(line, value(m))
+		}
+		fmt.Println("\t" + strings.Join(line, ", ") + ",")
+	}
+	fmt.Println("}")
+	fmt.Println()
+}
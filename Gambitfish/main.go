@@ -4,6 +4,9 @@ package main
 
 import "./game"
 import "./player"
+import "./io"
+import "./engine/search"
+import "flag"
 import "fmt"
 import "log"
 import "math/rand"
@@ -11,7 +14,14 @@ import "runtime/pprof"
 import "os"
 import "time"
 
+var uci = flag.Bool("uci", false, "Speak the UCI protocol on stdin/stdout instead of playing on the command line.")
+var hash = flag.Int("hash", game.DEFAULT_HASH_MB, "Size of the transposition table in megabytes.")
+var hashFile = flag.String("hashfile", "", "Load the transposition table from this file if it exists, and save it there when the game ends.")
+var contempt = flag.Float64("contempt", 0.0, "How many pawns worse than equal the engine thinks a draw is.")
+var copyMake = flag.Bool("copymake", false, "Search by copying the board at every move, instead of making and unmaking moves.")
+
 func main() {
+	flag.Parse()
 	f, err := os.Create("pprof.cpu")
 	if err != nil {
 		log.Fatal(err)
@@ -21,6 +31,7 @@ func main() {
 	rand.Seed(time.Now().Unix())
 	game.InitInternalData()
 	b := game.DefaultBoard()
+	// Each engine gives the evaluators a pawn table of its own.
 	e := game.CompoundEvaluator{
 		Evaluators: []game.Evaluator{
 			game.MaterialEvaluator{},
@@ -28,11 +39,31 @@ func main() {
 			// Calculating legal moves may be slowing this down. 
 			// game.MobilityEvaluator{},
 			// game.KingSafetyEvaluator{},
+			game.PawnStructureEvaluator{},
+			game.PassedPawnEvaluator{},
 		},
 	}
+	engine := search.NewEngine(e, *hash)
+	engine.Contempt = *contempt
+	engine.CopyMake = *copyMake
+	if *hashFile != "" {
+		if err := engine.TT.LoadFile(*hashFile); err != nil && !os.IsNotExist(err) {
+			log.Fatal(err)
+		}
+	}
+	if *uci {
+		u := io.NewUCI(engine, 7, os.Stdout)
+		u.HashFile = *hashFile
+		if err := u.Run(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	p1 := player.CommandLinePlayer{Color: game.WHITE}
-//	p1 := player.AIPlayer{Evaluator: e, Depth: 5, Color: game.WHITE}
-	p2 := player.AIPlayer{Evaluator: e, Depth: 7, Color: game.BLACK}
+	// An AI opponent needs an engine of its own.
+//	p1 := player.AIPlayer{Engine: search.NewEngine(e, *hash), Depth: 5, Color: game.WHITE}
+	p2 := player.AIPlayer{Engine: engine, Depth: 7, Color: game.BLACK, Ponder: true}
+	defer p2.StopPondering()
 	b.Print()
 	for i := 0; i < 300; i++ {
 		//time.Sleep(1 * time.Second)
@@ -42,8 +73,12 @@ func main() {
 			} else {
 				if len(b.AllLegalMoves()) == 0 {
 					fmt.Println("GAME ends in STALEMATE! no legal moves!")
-				} else {
+				} else if b.IsThreefoldRepetition() {
 					fmt.Println("GAME ends in DRAW by threefold repetition.")
+				} else if b.IsFiftyMoveDraw() {
+					fmt.Println("GAME ends in DRAW by the fifty-move rule.")
+				} else {
+					fmt.Println("GAME ends in DRAW by insufficient material.")
 				}
 			}
 			break
@@ -53,12 +88,14 @@ func main() {
 		} else {
 			p2.MakeMove(b)
 		}
-		b.SwitchActivePlayer()
-
-		// Every turn flush the table of entries that haven't been used.
-		game.EraseOldTableEntries()
 
 		fmt.Println("new board: ")
 		b.Print()
 	}
+	fmt.Println(fmt.Sprintf("pawn table: %v", engine.Pawns))
+	if *hashFile != "" {
+		if err := engine.TT.SaveFile(*hashFile); err != nil {
+			log.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,158 @@
+// Command perft counts the positions reachable from a position, to test
+// the move generator and measure its speed.
+//
+//	perft -fen "<fen>" -depth 5
+//
+// prints the count below each legal move (a "divide"), the total and the
+// nodes per second. With -epd it instead runs every position in an EPD
+// perft suite, where each line is a fen followed by the expected counts:
+//
+//	rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 20 ;D2 400
+package main
+
+import "../game"
+import "../io"
+import "bufio"
+import "flag"
+import "fmt"
+import "log"
+import "os"
+import "runtime"
+import "strconv"
+import "strings"
+import "time"
+
+var fen = flag.String("fen", io.STARTPOS_FEN, "The position to count from.")
+var depth = flag.Int("depth", 5, "How many plies deep to count. With -epd, the deepest count to check.")
+var hash = flag.Int("hash", 0, "Size of the hash table in megabytes, or 0 to count without one.")
+var threads = flag.Int("threads", runtime.NumCPU(), "How many goroutines share the root moves.")
+var epd = flag.String("epd", "", "Run the perft suite in this EPD file instead of a single position.")
+
+func main() {
+	flag.Parse()
+	if *depth < 1 {
+		log.Fatal("-depth must be at least 1")
+	}
+	game.InitInternalData()
+	if *epd != "" {
+		if !runSuite(*epd) {
+			os.Exit(1)
+		}
+		return
+	}
+	b, err := game.BoardFromFen(*fen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	start := time.Now()
+	res := game.PerftDivide(b, *depth, newTable(), *threads)
+	elapsed := time.Since(start)
+	var total uint64
+	for _, r := range res {
+		fmt.Println(fmt.Sprintf("%v: %v", io.MoveString(r.Move), r.Count))
+		total += r.Count
+	}
+	fmt.Println()
+	fmt.Println(fmt.Sprintf("Moves: %v", len(res)))
+	fmt.Println(fmt.Sprintf("Nodes: %v", total))
+	fmt.Println(fmt.Sprintf("Time: %v", elapsed))
+	fmt.Println(fmt.Sprintf("NPS: %v", nps(total, elapsed)))
+}
+
+// newTable returns a fresh hash table, or nil if -hash is 0.
+func newTable() *game.PerftTable {
+	if *hash <= 0 {
+		return nil
+	}
+	return game.NewPerftTable(*hash)
+}
+
+func nps(nodes uint64, elapsed time.Duration) uint64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return uint64(float64(nodes) / elapsed.Seconds())
+}
+
+// suiteEntry is one line of an EPD perft suite.
+type suiteEntry struct {
+	fen    string
+	counts map[int]uint64 // Expected counts by depth.
+}
+
+// parseSuiteLine reads a line like "<fen> ;D1 20 ;D2 400". The fen may
+// leave off the move counters, as EPD does.
+func parseSuiteLine(line string) (suiteEntry, error) {
+	parts := strings.Split(line, ";")
+	e := suiteEntry{fen: strings.TrimSpace(parts[0]), counts: make(map[int]uint64)}
+	if len(strings.Fields(e.fen)) == 4 {
+		e.fen += " 0 1"
+	}
+	for _, p := range parts[1:] {
+		f := strings.Fields(p)
+		if len(f) != 2 || !strings.HasPrefix(f[0], "D") {
+			return e, fmt.Errorf("invalid perft count: %v", p)
+		}
+		d, err := strconv.Atoi(f[0][1:])
+		if err != nil {
+			return e, fmt.Errorf("invalid perft depth: %v", f[0])
+		}
+		n, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			return e, fmt.Errorf("invalid perft count: %v", f[1])
+		}
+		e.counts[d] = n
+	}
+	return e, nil
+}
+
+// runSuite checks every count up to -depth in the suite at path, and
+// returns true if they all match.
+func runSuite(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	passed, failed := 0, 0
+	var nodes uint64
+	start := time.Now()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		e, err := parseSuiteLine(text)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("%v:%v: %v", path, line, err))
+		}
+		b, err := game.BoardFromFen(e.fen)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("%v:%v: %v", path, line, err))
+		}
+		for d := 1; d <= *depth; d++ {
+			want, ok := e.counts[d]
+			if !ok {
+				continue
+			}
+			var got uint64
+			for _, r := range game.PerftDivide(b, d, newTable(), *threads) {
+				got += r.Count
+			}
+			nodes += got
+			if got != want {
+				failed++
+				fmt.Println(fmt.Sprintf("FAIL %v depth %v: got %v, want %v", e.fen, d, got, want))
+				continue
+			}
+			passed++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	fmt.Println(fmt.Sprintf("%v passed, %v failed, %v nodes in %v (%v nps)", passed, failed, nodes, elapsed, nps(nodes, elapsed)))
+	return failed == 0
+}
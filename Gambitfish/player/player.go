@@ -3,74 +3,158 @@ package player
 import "bufio"
 import "errors"
 import "fmt"
-import "math"
 import "os"
 import "strings"
 import "time"
 import "../game"
 import "../engine/search"
 
+// Player chooses moves in a game. MakeMove makes its move on the board
+// with Push, leaving the opponent to move.
 type Player interface {
 	MakeMove(*game.Board) error
 }
 
 // AIPlayer is a player that makes moves according to AI.
 type AIPlayer struct {
-	Evaluator game.Evaluator
-	Depth     int
-	Color     game.Color
+	// Engine does the searching, and keeps what it learns between moves.
+	Engine *search.Engine
+	Depth  int
+	Color  game.Color
+	// MoveTime limits how long the player thinks about a move. Iterative
+	// deepening stops at Depth or when time runs out, whichever is first.
+	// A zero MoveTime searches to Depth no matter how long it takes.
+	MoveTime time.Duration
+	// Ponder makes the player search the reply it expects while the
+	// opponent is thinking.
+	Ponder bool
+
+	pondering *ponderSearch
+}
+
+// ponderSearch is a search running in the background on the position we
+// expect after the opponent's reply.
+type ponderSearch struct {
+	move     game.EfficientMove // The opponent move we are pondering on.
+	position game.Position      // The position after that move.
+	result   chan search.Result
 }
 
 func (p *AIPlayer) MakeMove(b *game.Board) error {
 	start := time.Now()
-	km := game.NewKillerMoves()
-	// Use iterative deepening to try and find good paths early. It's likely that
-	// the best move on ply 1 is the best on ply 2. This fills the transposition table
-	// to lead with the best move on future plies.
-	var eval float64
-	var move game.EfficientMove
-	var nodes int
-	alpha := math.Inf(-1)
-	beta := math.Inf(1)
-	d := 1
-	for d <= p.Depth {
-		eval, move, nodes = search.AlphaBetaSearch(b, p.Evaluator, d, alpha, beta, false, p.Color, km)
-		fmt.Println(fmt.Sprintf("iteration %v: best move is %v (%v nodes searched)", d, move, nodes))
-		d++
+	res, ok := p.ponderHit(b)
+	if !ok {
+		p.Engine.Reset()
+		if p.MoveTime > 0 {
+			p.Engine.SetDeadline(start.Add(p.MoveTime))
+		}
+		res = p.Engine.IterativeDeepening(b, p.Depth, func(r search.Result) {
+			fmt.Println(fmt.Sprintf("iteration %v: best move is %v (%v)", r.Depth, r.Move, r.Stats))
+		})
 	}
 	t := time.Since(start)
 	fmt.Println(fmt.Sprintf("evaluation over in: %v", t))
-	if move == game.EfficientMove(0) {
+	if res.Move == game.EfficientMove(0) {
 		return errors.New("no move could be made")
 	}
+	eval := res.Eval
 	// Convert eval to + for white, - for black.
 	if p.Color == game.BLACK {
 		eval = -1 * eval
 	}
-	fmt.Println(fmt.Sprintf("AI Player making best move with depth %v: %v, eval %v", p.Depth, move, eval))
-	// Principal Variation has a crashing bug.
-
-	//PrintPrincipalVariation(b)
-	game.ApplyMove(b, move)
+	fmt.Println(fmt.Sprintf("AI Player making best move with depth %v: %v, eval %v", res.Depth, res.Move, eval))
+	fmt.Println(fmt.Sprintf("search stats: %v", res.Stats))
+	PrintPrincipalVariation(b, p.Engine.TT)
+	reply := p.Engine.ExpectedReply(b, res.Move)
+	b.Push(res.Move)
+	if p.Ponder && reply != game.EfficientMove(0) {
+		p.startPondering(b, reply)
+	}
 	return nil
 }
 
+// startPondering begins searching in the background for our answer to
+// reply, the move we expect the opponent to make. b must have our move
+// made, with the opponent to move.
+func (p *AIPlayer) startPondering(b *game.Board, reply game.EfficientMove) {
+	p.StopPondering()
+	pb := b.Clone()
+	pb.Push(reply)
+	ps := &ponderSearch{
+		move:     reply,
+		position: pb.Position,
+		result:   make(chan search.Result, 1),
+	}
+	fmt.Println(fmt.Sprintf("pondering on %v", reply))
+	p.Engine.Reset()
+	go func() {
+		ps.result <- p.Engine.IterativeDeepening(pb, p.Depth, nil)
+	}()
+	p.pondering = ps
+}
+
+// ponderHit checks whether the opponent played the move we were pondering
+// on. If so, the ponder search becomes a normal search with the player's
+// time limit, and its result is returned. Otherwise the ponder search is
+// discarded and ok is false.
+func (p *AIPlayer) ponderHit(b *game.Board) (res search.Result, ok bool) {
+	ps := p.pondering
+	if ps == nil {
+		return search.Result{}, false
+	}
+	if b.LastMove != ps.move || b.Position != ps.position {
+		p.StopPondering()
+		return search.Result{}, false
+	}
+	p.pondering = nil
+	fmt.Println(fmt.Sprintf("ponderhit on %v", ps.move))
+	if p.MoveTime > 0 {
+		p.Engine.SetDeadline(time.Now().Add(p.MoveTime))
+	}
+	res = <-ps.result
+	if res.Move == game.EfficientMove(0) {
+		return search.Result{}, false
+	}
+	return res, true
+}
+
+// StopPondering abandons any ponder search in progress and waits for it
+// to finish, after which it is safe to search again.
+func (p *AIPlayer) StopPondering() {
+	if p.pondering == nil {
+		return
+	}
+	p.Engine.Stop()
+	<-p.pondering.result
+	p.pondering = nil
+}
+
 // CommandLinePlayer is a player that makes moves according to input from the command line.
 type CommandLinePlayer struct {
 	Color game.Color
 }
 
+// TAKEBACK is what a CommandLinePlayer types instead of a square to take
+// back their last move, and the opponent's reply to it.
+const TAKEBACK = "takeback"
+
 func (p *CommandLinePlayer) MakeMove(b *game.Board) error {
 	reader := bufio.NewReader(os.Stdin)
-	// Compare legal moves against the input choice.
-	moves := b.AllLegalMoves()
 	var move game.EfficientMove
 	foundMove := false
 	for !foundMove {
+		// Compare legal moves against the input choice.
+		moves := b.AllLegalMoves()
 		candidates := []game.EfficientMove{}
-		fmt.Println("Please input a move. What square is the piece you would like to move? (for castling, start with the king)")
-		b, _, _ := reader.ReadLine()
-		from := string(b)
+		fmt.Println(fmt.Sprintf("Please input a move. What square is the piece you would like to move? (for castling, start with the king, or type %v to take back your last move)", TAKEBACK))
+		line, _, _ := reader.ReadLine()
+		from := string(line)
+		if from == TAKEBACK {
+			if !takeback(b) {
+				fmt.Println("You haven't made a move to take back.")
+			}
+			continue
+		}
 		for _, m := range moves {
 			if m.Old().String() == from {
 				candidates = append(candidates, m)
@@ -81,8 +165,8 @@ func (p *CommandLinePlayer) MakeMove(b *game.Board) error {
 			continue
 		}
 		fmt.Println("What square would you like to move to? (for castling, move the king)")
-		b, _, _ = reader.ReadLine()
-		to := string(b)
+		line, _, _ = reader.ReadLine()
+		to := string(line)
 		for _, c := range candidates {
 			if c.Square().String() == to {
 				move = c
@@ -94,38 +178,51 @@ func (p *CommandLinePlayer) MakeMove(b *game.Board) error {
 		}
 		fmt.Println(fmt.Sprintf("No legal moves from %v to %v. Please try again.", from, to))
 	}
-	game.ApplyMove(b, move)
+	b.Push(move)
 	return nil
 }
 
+// takeback pops the opponent's last move and the move before it, which was
+// ours, and prints the board. It returns false if we haven't moved yet.
+func takeback(b *game.Board) bool {
+	if len(b.AllMoves) < 2 {
+		return false
+	}
+	b.Pop()
+	b.Pop()
+	b.Print()
+	return true
+}
+
 // Print principal variation prints the expected best continuation
 // from a given board.
-func PrintPrincipalVariation(b *game.Board) {
+func PrintPrincipalVariation(b *game.Board, tt *game.TransTable) {
 	moves := []game.EfficientMove{}
-	bs := []game.BoardState{}
 	seenMoves := make(map[game.EfficientMove]bool)
 	// Get the principal variation, change board state.
 	for {
-		entry, ok := game.TranspositionTable[game.ZobristHash(b)]
-		if !ok || entry.BestMove == game.EfficientMove(0) {
+		entry, ok := tt.Probe(b.Hash)
+		if !ok {
+			break
+		}
+		move := entry.BestMove.Resolve(b.AllLegalMoves())
+		if move == game.EfficientMove(0) {
 			break
 		}
 		// Break after first repetition
-		if seenMoves[entry.BestMove] {
+		if seenMoves[move] {
 			break
 		}
-		moves = append(moves, entry.BestMove)
-		seenMoves[entry.BestMove] = true
-		b.SwitchActivePlayer()
-		bs = append(bs, game.ApplyMove(b, entry.BestMove))
+		moves = append(moves, move)
+		seenMoves[move] = true
+		b.Push(move)
 	}
 	// Undo board state.
-	for i := len(moves) - 1; i >= 0; i-- {
-		game.UndoMove(b, moves[i], bs[i])
-		b.SwitchActivePlayer()
+	for range moves {
+		b.Pop()
 	}
 	// Print the principal variation.
-	entry := game.TranspositionTable[game.ZobristHash(b)]
+	entry, _ := tt.Probe(b.Hash)
 	fmt.Printf("\nEvaluation at Depth %v: %v\n", entry.Depth, entry.Eval)
 	fmt.Println("Principal Variation: ")
 	pvStrings := []string{}